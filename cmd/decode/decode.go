@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/pkg/errors"
+	"github.com/ss-continuum/ssc/pkg/bytestream"
+	"github.com/ss-continuum/ssc/pkg/directory"
+	"github.com/ss-continuum/ssc/pkg/dissect"
+	"github.com/ss-continuum/ssc/pkg/logbytes"
+	"github.com/ss-continuum/ssc/pkg/packetmap"
+	"github.com/ss-continuum/ssc/pkg/pcapng"
+)
+
+func main() {
+	fs := flag.NewFlagSet("ssc-decode", flag.ExitOnError)
+
+	d := decoder{
+		corePorts:      newPortSet("4990,5000"),
+		pingPorts:      newPortSet("5001"),
+		directoryPorts: newPortSet("4990"),
+		flows:          map[flowKey]*flow{},
+		out:            os.Stdout,
+	}
+
+	fs.Var(d.corePorts, "ports", "server ports speaking the core protocol")
+	fs.Var(d.pingPorts, "ping-ports", "server ports speaking the ping protocol")
+	fs.Var(d.directoryPorts, "directory-ports", "server ports whose reassembled messages are directory lists")
+	fs.BoolVar(&d.json, "json", false, "emit JSON lines instead of text")
+
+	root := &ffcli.Command{
+		ShortUsage: fmt.Sprintf("%s [-json] [-ports <list>] [-ping-ports <list>] [-directory-ports <list>] file", os.Args[0]),
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return errors.Errorf("Unexpected number of args. Expected: 1, got: %d", len(args))
+			}
+
+			f, err := os.Open(args[0])
+			if err != nil {
+				return errors.Wrap(err, "os.Open")
+			}
+			defer f.Close()
+
+			r, err := pcapng.NewReader(f)
+			if err != nil {
+				return errors.Wrap(err, "pcapng.NewReader")
+			}
+
+			return d.run(r)
+		},
+	}
+
+	if err := root.ParseAndRun(context.Background(), os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type decoder struct {
+	corePorts      *portSet
+	pingPorts      *portSet
+	directoryPorts *portSet
+	json           bool
+
+	flows map[flowKey]*flow
+	order []flowKey // flows in order of appearance
+	last  time.Time // time of the last datagram
+	out   io.Writer
+}
+
+// event is one line of output: a datagram or a reassembled message.
+type event struct {
+	Time      time.Time      `json:"time"`
+	Src       netip.AddrPort `json:"src"`
+	Dst       netip.AddrPort `json:"dst"`
+	Direction string         `json:"direction"`
+
+	Packet  *dissect.Node `json:"packet,omitempty"`
+	Message *message      `json:"message,omitempty"`
+}
+
+type message struct {
+	Size      int                  `json:"size"`
+	Data      []byte               `json:"data,omitempty"`
+	Directory *directory.Directory `json:"directory,omitempty"`
+	Error     string               `json:"error,omitempty"`
+}
+
+func (d *decoder) run(r *pcapng.Reader) error {
+	for {
+		p, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return d.finish()
+		}
+		if err != nil {
+			return errors.Wrap(err, "r.Next")
+		}
+
+		datagram, ok := pcapng.ParseUDP(p)
+		if !ok {
+			continue
+		}
+
+		if err := d.handle(datagram); err != nil {
+			return err
+		}
+	}
+}
+
+func (d *decoder) handle(dg pcapng.Datagram) error {
+	var key flowKey
+	var dir int
+	var ping bool
+
+	switch {
+	case d.corePorts.Has(dg.Dst.Port()) || d.pingPorts.Has(dg.Dst.Port()):
+		key, dir, ping = flowKey{client: dg.Src, server: dg.Dst}, clientToServer, d.pingPorts.Has(dg.Dst.Port())
+	case d.corePorts.Has(dg.Src.Port()) || d.pingPorts.Has(dg.Src.Port()):
+		key, dir, ping = flowKey{client: dg.Dst, server: dg.Src}, serverToClient, d.pingPorts.Has(dg.Src.Port())
+	default:
+		return nil
+	}
+
+	f, ok := d.flows[key]
+	if !ok {
+		// the connection starts in the capture when its first packet is the encryption request
+		start := len(dg.Payload) >= 2 && dg.Payload[0] == 0x00 && dg.Payload[1] == 0x01
+		f = newFlow(ping, start)
+		d.flows[key] = f
+		d.order = append(d.order, key)
+	}
+	d.last = dg.Time
+
+	ev := event{Time: dg.Time, Src: dg.Src, Dst: dg.Dst, Direction: directionNames[dir]}
+
+	ev.Packet = f.dissect(dir, dg.Payload)
+	if err := d.emit(ev); err != nil {
+		return err
+	}
+	ev.Packet = nil
+
+	if ping {
+		return nil
+	}
+
+	for _, rel := range reliablePackets(dg.Payload) {
+		for _, p := range f.reliable[dir].add(rel.id, rel.payload) {
+			if err := d.reassemble(f, dir, key, ev, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// reassemble passes a reliable packet, in order, to the chunk reassembler and emits the messages it completes.
+func (d *decoder) reassemble(f *flow, dir int, key flowKey, ev event, p reliablePacket) error {
+	var err error
+	if packetmap.IsChunk(p.payload) {
+		err = f.chunks[dir].Add(p.id, p.payload)
+	} else {
+		err = f.chunks[dir].Skip(p.id)
+	}
+
+	if err != nil {
+		ev.Message = &message{Error: err.Error()}
+		if err := d.emit(ev); err != nil {
+			return err
+		}
+	}
+
+	for _, data := range f.messages[dir] {
+		ev.Message = d.message(key, dir, data)
+		if err := d.emit(ev); err != nil {
+			return err
+		}
+	}
+	f.messages[dir] = nil
+
+	return nil
+}
+
+// finish reports the reliable packets missing from the capture, which hold back the ones received after them.
+func (d *decoder) finish() error {
+	for _, key := range d.order {
+		f := d.flows[key]
+		for dir := range f.reliable {
+			missing := f.reliable[dir].missing()
+			if len(missing) == 0 {
+				continue
+			}
+
+			ev := event{Time: d.last, Src: key.client, Dst: key.server, Direction: directionNames[dir]}
+			if dir == serverToClient {
+				ev.Src, ev.Dst = key.server, key.client
+			}
+			ev.Message = &message{Error: fmt.Sprintf("reliable packets %v missing from the capture, %d received after them not decoded",
+				missing, len(f.reliable[dir].pending))}
+			if err := d.emit(ev); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *decoder) message(key flowKey, dir int, data []byte) *message {
+	m := &message{Size: len(data), Data: data}
+
+	if dir == serverToClient && d.directoryPorts.Has(key.server.Port()) {
+		list, err := directory.NewFromStream(bytestream.New(data, endian))
+		if err != nil {
+			m.Error = err.Error()
+		} else {
+			m.Directory = &list
+			m.Data = nil
+		}
+	}
+
+	return m
+}
+
+func (d *decoder) emit(ev event) error {
+	if d.json {
+		b, err := json.Marshal(ev)
+		if err != nil {
+			return errors.Wrap(err, "json.Marshal")
+		}
+		_, err = fmt.Fprintf(d.out, "%s\n", b)
+		return err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s %s -> %s\n", ev.Time.Format("2006-01-02 15:04:05.000000"), ev.Direction, ev.Src, ev.Dst)
+
+	if ev.Packet != nil {
+		sb.WriteString(indent(ev.Packet.String()))
+	}
+
+	if m := ev.Message; m != nil {
+		if m.Error != "" {
+			fmt.Fprintf(&sb, "  reassembly error: %s\n", m.Error)
+		} else {
+			fmt.Fprintf(&sb, "  reassembled message, %d bytes\n", m.Size)
+		}
+		if m.Directory != nil {
+			for _, entry := range m.Directory.Entries {
+				sb.WriteString("  ---\n")
+				sb.WriteString(indent(entry.String()))
+			}
+		} else if len(m.Data) > 0 {
+			logbytes.New(&sb).DumpPrefix(m.Data, " ")
+		}
+	}
+
+	_, err := io.WriteString(d.out, sb.String())
+	return err
+}
+
+func indent(s string) string {
+	return "  " + strings.ReplaceAll(s, "\n", "\n  ") + "\n"
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ss-continuum/ssc/pkg/pcapng"
+)
+
+var (
+	testClient = netip.MustParseAddrPort("10.0.0.1:50000")
+	testServer = netip.MustParseAddrPort("10.0.0.2:5000")
+)
+
+func reliable(id uint32, payload ...byte) []byte {
+	return append([]byte{0x00, 0x03, byte(id), byte(id >> 8), byte(id >> 16), byte(id >> 24)}, payload...)
+}
+
+func cluster(packets ...[]byte) []byte {
+	b := []byte{0x00, 0x0e}
+	for _, p := range packets {
+		b = append(b, byte(len(p)))
+		b = append(b, p...)
+	}
+	return b
+}
+
+// decodeMessages feeds the server datagrams of a connection to a decoder and returns the reassembled messages
+// and errors.
+func decodeMessages(t *testing.T, datagrams ...[]byte) (messages []string, errs []string) {
+	t.Helper()
+
+	var out bytes.Buffer
+	d := decoder{
+		corePorts:      newPortSet("5000"),
+		pingPorts:      newPortSet(""),
+		directoryPorts: newPortSet(""),
+		json:           true,
+		flows:          map[flowKey]*flow{},
+		out:            &out,
+	}
+
+	now := time.Unix(0, 0)
+	if err := d.handle(pcapng.Datagram{Time: now, Src: testClient, Dst: testServer, Payload: []byte{0x00, 0x01, 1, 2, 3, 4, 0x01, 0x00}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range datagrams {
+		if err := d.handle(pcapng.Datagram{Time: now, Src: testServer, Dst: testClient, Payload: b}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var ev event
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Message == nil {
+			continue
+		}
+		if ev.Message.Error != "" {
+			errs = append(errs, ev.Message.Error)
+		} else {
+			messages = append(messages, string(ev.Message.Data))
+		}
+	}
+	return messages, errs
+}
+
+func TestReliableCluster(t *testing.T) {
+	tests := []struct {
+		name      string
+		datagrams [][]byte
+		want      []string
+		errors    int
+	}{
+		{
+			name: "chunks in a reliable cluster",
+			datagrams: [][]byte{
+				reliable(0, cluster([]byte{0x00, 0x08, 'a'}, []byte{0x00, 0x08, 'b'}, []byte{0x00, 0x09, 'c'})...),
+			},
+			want: []string{"abc"},
+		},
+		{
+			name: "reliable cluster between reliable chunks",
+			datagrams: [][]byte{
+				reliable(0, 0x00, 0x08, 'a'),
+				reliable(1, cluster([]byte{0x00, 0x08, 'b'}, []byte{0x02, 'x'}, []byte{0x00, 0x08, 'c'})...),
+				reliable(2, 0x00, 0x09, 'd'),
+			},
+			want: []string{"abcd"},
+		},
+		{
+			name: "reordered and duplicated",
+			datagrams: [][]byte{
+				reliable(1, 0x00, 0x09, 'c'),
+				reliable(1, 0x00, 0x09, 'c'),
+				cluster(reliable(0, cluster([]byte{0x00, 0x08, 'a'}, []byte{0x00, 0x08, 'b'})...), []byte{0x00, 0x04, 0, 0, 0, 0}),
+				reliable(0, cluster([]byte{0x00, 0x08, 'a'}, []byte{0x00, 0x08, 'b'})...),
+			},
+			want: []string{"abc"},
+		},
+		{
+			name: "missing from the capture",
+			datagrams: [][]byte{
+				reliable(0, 0x00, 0x09, 'a'),
+				reliable(2, 0x00, 0x09, 'c'),
+			},
+			want:   []string{"a"},
+			errors: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		got, errs := decodeMessages(t, tt.datagrams...)
+		if len(errs) != tt.errors {
+			t.Errorf("%s: errors %q, want %d", tt.name, errs, tt.errors)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: messages %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/binary"
+	"net/netip"
+
+	"github.com/ss-continuum/ssc/pkg/connection/server"
+	"github.com/ss-continuum/ssc/pkg/dissect"
+	"github.com/ss-continuum/ssc/pkg/packetmap"
+)
+
+var endian = binary.LittleEndian
+
+const (
+	clientToServer = iota
+	serverToClient
+)
+
+var directionNames = [2]string{"C2S", "S2C"}
+
+type flowKey struct {
+	client, server netip.AddrPort
+}
+
+// flow is the state kept for one client talking to one server port.
+type flow struct {
+	ping        bool
+	pingVersion int // version of the last ping request, to decode the response
+
+	dissectors [2]*dissect.Dissector
+	reliable   [2]reliableOrder
+	chunks     [2]*packetmap.Reassembler
+	messages   [2][][]byte // messages completed by chunks, waiting to be emitted
+}
+
+// newFlow returns the state of a flow. start tells whether the capture has the start of the connection, where
+// reliable ids begin at 0.
+func newFlow(ping, start bool) *flow {
+	f := &flow{
+		ping:        ping,
+		pingVersion: 1,
+		dissectors:  [2]*dissect.Dissector{{}, {}},
+	}
+	for dir := range f.chunks {
+		dir := dir
+		f.chunks[dir] = packetmap.NewReassembler(func(data []byte) error {
+			f.messages[dir] = append(f.messages[dir], data)
+			return nil
+		})
+		if start {
+			f.reliable[dir].hasNext = true
+		} else {
+			f.chunks[dir].Join()
+		}
+	}
+	return f
+}
+
+func (f *flow) dissect(dir int, payload []byte) *dissect.Node {
+	if !f.ping {
+		return f.dissectors[dir].Dissect(payload)
+	}
+
+	if dir == clientToServer {
+		f.pingVersion = 1
+		if len(payload) == 8 {
+			f.pingVersion = 2
+		}
+		return dissect.PingRequest(payload)
+	}
+
+	if f.pingVersion == 2 {
+		return dissect.PingV2Response(payload)
+	}
+	return dissect.PingV1Response(payload)
+}
+
+type reliablePacket struct {
+	id      uint32
+	payload []byte
+}
+
+// reliablePackets returns the 0x00 0x03 reliable packets carried by b, looking inside clusters.
+func reliablePackets(b []byte) []reliablePacket {
+	var ret []reliablePacket
+	for _, p := range server.Unpack(b) {
+		if len(p) < 6 || p[0] != 0x00 || p[1] != 0x03 {
+			continue
+		}
+		ret = append(ret, reliablePacket{id: endian.Uint32(p[2:6]), payload: p[6:]})
+	}
+	return ret
+}
+
+// maxWindow is how far past the next expected id a reliable packet is buffered, as the receiving end does.
+const maxWindow = 256
+
+// reliableOrder puts the reliable packets of one direction back in id order and drops the copies, as the
+// receiving end does. The packets unpacked from a reliable cluster share an id, so the packets it returns are
+// numbered in order of delivery instead, for the Reassembler.
+type reliableOrder struct {
+	next    uint32
+	hasNext bool // unset until the first packet of a flow whose start is not in the capture
+	pending map[uint32][]byte
+	seq     uint32 // packets delivered so far
+}
+
+// add stores the payload of reliable packet id and returns the packets that are next in line.
+func (o *reliableOrder) add(id uint32, payload []byte) []reliablePacket {
+	if !o.hasNext {
+		o.next, o.hasNext = id, true
+	}
+	if ahead := id - o.next; ahead >= 1<<31 || ahead >= maxWindow {
+		return nil
+	}
+
+	if o.pending == nil {
+		o.pending = make(map[uint32][]byte)
+	}
+	if _, ok := o.pending[id]; !ok {
+		o.pending[id] = payload
+	}
+
+	var ret []reliablePacket
+	for {
+		payload, ok := o.pending[o.next]
+		if !ok {
+			return ret
+		}
+		delete(o.pending, o.next)
+		o.next++
+
+		for _, p := range server.Unpack(payload) {
+			ret = append(ret, reliablePacket{id: o.seq, payload: p})
+			o.seq++
+		}
+	}
+}
+
+// missing returns the ids of the reliable packets holding back the ones already received, in order.
+func (o *reliableOrder) missing() []uint32 {
+	last := o.next
+	for id := range o.pending {
+		if id-o.next > last-o.next {
+			last = id
+		}
+	}
+
+	var missing []uint32
+	for id := o.next; len(o.pending) > 0 && id != last; id++ {
+		if _, ok := o.pending[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// portSet is a flag value holding a comma separated list of ports and port ranges, such as "4990,5000-5010".
+type portSet struct {
+	spec  string
+	ports map[uint16]bool
+}
+
+func newPortSet(spec string) *portSet {
+	p := &portSet{}
+	if err := p.Set(spec); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func (p *portSet) Has(port uint16) bool {
+	return p.ports[port]
+}
+
+func (p *portSet) String() string {
+	if p == nil {
+		return ""
+	}
+	return p.spec
+}
+
+func (p *portSet) Set(s string) error {
+	p.spec, p.ports = s, map[uint16]bool{}
+
+	for _, piece := range strings.Split(s, ",") {
+		if piece == "" {
+			continue
+		}
+
+		from, to := piece, piece
+		if i := strings.IndexByte(piece, '-'); i >= 0 {
+			from, to = piece[:i], piece[i+1:]
+		}
+
+		lo, err := strconv.ParseUint(from, 10, 16)
+		if err != nil {
+			return errors.Errorf("bad port %q", from)
+		}
+		hi, err := strconv.ParseUint(to, 10, 16)
+		if err != nil {
+			return errors.Errorf("bad port %q", to)
+		}
+
+		for port := lo; port <= hi; port++ {
+			p.ports[uint16(port)] = true
+		}
+	}
+
+	return nil
+}
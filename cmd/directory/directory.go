@@ -10,6 +10,11 @@ import (
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"github.com/pkg/errors"
 	"github.com/ss-continuum/ssc/pkg/connection/directory"
+	"github.com/ss-continuum/ssc/pkg/debugmode"
+	"github.com/ss-continuum/ssc/pkg/dissect"
+	"github.com/ss-continuum/ssc/pkg/logbytes"
+	"github.com/ss-continuum/ssc/pkg/pcapng"
+	"github.com/ss-continuum/ssc/pkg/vie"
 )
 
 const directoryServerPort = 4990
@@ -18,13 +23,17 @@ func main() {
 	fs := flag.NewFlagSet("ssc-directory", flag.ExitOnError)
 
 	var Port int
-	var Debug bool
+	var Debug debugmode.Mode
+	var Capture string
+	var Encrypt bool
 
 	fs.IntVar(&Port, "port", directoryServerPort, "server port")
-	fs.BoolVar(&Debug, "debug", false, "log network packets")
+	fs.Var(&Debug, "debug", "log network packets (-debug=dissect to decode them)")
+	fs.StringVar(&Capture, "capture", "", "write network packets to a pcapng file")
+	fs.BoolVar(&Encrypt, "encrypt", false, "negotiate VIE encryption")
 
 	root := &ffcli.Command{
-		ShortUsage: fmt.Sprintf("%s [-debug] [-port <portnumber>] address", os.Args[0]),
+		ShortUsage: fmt.Sprintf("%s [-debug[=dissect]] [-capture <file>] [-encrypt] [-port <portnumber>] address", os.Args[0]),
 		FlagSet:    fs,
 		Exec: func(ctx context.Context, args []string) error {
 			if len(args) != 1 {
@@ -41,8 +50,28 @@ func main() {
 			}
 			defer dirConn.Close()
 
-			dirConn.Debug = Debug
-			if err := dirConn.Login(0); err != nil {
+			switch Debug {
+			case debugmode.Hex:
+				dirConn.Debug = logbytes.NewLogger(log.Default())
+			case debugmode.Dissect:
+				dirConn.Debug = dissect.NewPrinter(log.Default())
+			}
+			if Capture != "" {
+				capture, err := pcapng.Create(Capture)
+				if err != nil {
+					return errors.Wrap(err, "pcapng.Create")
+				}
+				defer capture.Close()
+
+				dirConn.Capture = capture
+			}
+			var key uint32
+			if Encrypt {
+				if key, err = vie.GenerateKey(); err != nil {
+					return errors.Wrap(err, "vie.GenerateKey")
+				}
+			}
+			if err := dirConn.Login(key); err != nil {
 				return errors.Wrap(err, "login")
 			}
 			list, err := dirConn.Directory(0)
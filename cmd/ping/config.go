@@ -6,14 +6,16 @@ import (
 
 	"github.com/peterbourgon/ff/v3"
 	"github.com/pkg/errors"
+	"github.com/ss-continuum/ssc/pkg/debugmode"
 )
 
 type Config struct {
-	Addr  string
-	Port  int
-	Debug bool
-	V1    bool
-	V2    bool
+	Addr    string
+	Port    int
+	Debug   debugmode.Mode
+	Capture string
+	V1      bool
+	V2      bool
 
 	fs *flag.FlagSet
 }
@@ -29,7 +31,8 @@ func readConfig() (Config, error) {
 
 	c.fs.StringVar(&c.Addr, "addr", "", "server address")
 	c.fs.IntVar(&c.Port, "port", 5001, "server port")
-	c.fs.BoolVar(&c.Debug, "debug", false, "log network packets")
+	c.fs.Var(&c.Debug, "debug", "log network packets (-debug=dissect to decode them)")
+	c.fs.StringVar(&c.Capture, "capture", "", "write network packets to a pcapng file")
 	c.fs.BoolVar(&c.V1, "1", false, "use ping v1 (default)")
 	c.fs.BoolVar(&c.V2, "2", false, "use ping v2")
 
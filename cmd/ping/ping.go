@@ -3,6 +3,14 @@ package main
 import (
 	"fmt"
 	"log"
+	"net"
+	"strconv"
+
+	"github.com/ss-continuum/ssc/pkg/connection/server"
+	"github.com/ss-continuum/ssc/pkg/debugmode"
+	"github.com/ss-continuum/ssc/pkg/dissect"
+	"github.com/ss-continuum/ssc/pkg/logbytes"
+	"github.com/ss-continuum/ssc/pkg/pcapng"
 )
 
 func main() {
@@ -28,15 +36,45 @@ func main() {
 
 	log.Println("SSC Ping")
 
+	var debug logbytes.PacketLogger
+	switch conf.Debug {
+	case debugmode.Hex:
+		debug = logbytes.NewLogger(log.Default())
+	case debugmode.Dissect:
+		if conf.V2 {
+			debug = dissect.NewPingPrinter(log.Default(), 2)
+		} else {
+			debug = dissect.NewPingPrinter(log.Default(), 1)
+		}
+	}
+
+	conn, err := server.Dial(net.JoinHostPort(conf.Addr, strconv.Itoa(conf.Port)))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Raw = true // ping replies are not core packets
+	conn.Debug = debug
+	if conf.Capture != "" {
+		capture, err := pcapng.Create(conf.Capture)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer capture.Close()
+
+		conn.Capture = capture
+	}
+
 	if conf.V1 {
-		resp, err := PingV1(conf.Addr, conf.Port, conf.Debug)
+		resp, err := PingV1(conn)
 		if err != nil {
 			log.Fatal(err)
 		}
 
 		log.Println(resp)
 	} else if conf.V2 {
-		resp, err := PingV2(conf.Addr, conf.Port, conf.Debug, PingGlobalSummary|PingArenaSummary)
+		resp, err := PingV2(conn, PingGlobalSummary|PingArenaSummary)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -2,17 +2,16 @@ package main
 
 import (
 	"fmt"
-	"net"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/ss-continuum/ssc/pkg/bytestream"
-	"github.com/ss-continuum/ssc/pkg/logbytes"
+	"github.com/ss-continuum/ssc/pkg/connection/server"
 )
 
 type PingV1Resp struct {
-	PlayerCount uint32
-	ClientTime  uint32 // This is but an echo of what was sent to the server
+	PlayerCount uint32 `ssc:"u32"`
+	ClientTime  uint32 `ssc:"u32"` // This is but an echo of what was sent to the server
 
 	Lag uint32 // in milliseconds
 }
@@ -21,46 +20,29 @@ func (p PingV1Resp) String() string {
 	return fmt.Sprintf("PlayerCount: %d, Lag: %dms", p.PlayerCount, p.Lag)
 }
 
-func PingV1(ip string, port int, debug bool) (PingV1Resp, error) {
+func PingV1(conn *server.Connection) (PingV1Resp, error) {
 	var resp PingV1Resp
-	addr := fmt.Sprintf("%s:%d", ip, port)
-
-	conn, err := net.Dial("udp", addr)
-	if err != nil {
-		return resp, errors.Wrap(err, "net.Dial")
-	}
-	defer conn.Close()
 
 	then := uint32(time.Now().UnixMilli())
 
-	C2SSimplePingV1 := make([]byte, 4)
-	endian.PutUint32(C2SSimplePingV1, then)
-
-	if debug {
-		logbytes.LogPrefix(C2SSimplePingV1, "C2S |")
-	}
+	out := bytestream.NewWriter(endian)
+	out.WriteUint32(then)
+	C2SSimplePingV1 := out.Bytes()
 
 	if _, err := conn.Write(C2SSimplePingV1); err != nil {
 		return resp, errors.Wrap(err, "conn.Write")
 	}
 
-	respBytes := make([]byte, 8)
-	n, err := conn.Read(respBytes)
+	respBytes, err := conn.ReadWithDeadline(readTimeout)
 	if err != nil {
-		return resp, errors.Wrap(err, "conn.Read")
-	}
-	if debug {
-		logbytes.LogPrefix(respBytes, "S2C |")
+		return resp, errors.Wrap(err, "conn.ReadWithDeadline")
 	}
-	in := bytestream.New(respBytes[:n], endian)
+	in := bytestream.New(respBytes, endian)
 
 	now := uint32(time.Now().UnixMilli())
 
-	if err := in.ReadUint32Var(&resp.PlayerCount); err != nil {
-		return resp, errors.Wrap(err, "in.ReadUint32Var")
-	}
-	if err := in.ReadUint32Var(&resp.ClientTime); err != nil {
-		return resp, errors.Wrap(err, "in.ReadUint32Var")
+	if err := bytestream.Unmarshal(in, &resp); err != nil {
+		return resp, errors.Wrap(err, "bytestream.Unmarshal")
 	}
 
 	resp.Lag = now - then
@@ -3,21 +3,20 @@ package main
 import (
 	"encoding/binary"
 	"fmt"
-	"net"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/ss-continuum/ssc/pkg/bytestream"
-	"github.com/ss-continuum/ssc/pkg/logbytes"
+	"github.com/ss-continuum/ssc/pkg/connection/server"
 )
 
 const PingGlobalSummary = 0x01
 const PingArenaSummary = 0x02
 
 type PingV2Resp struct {
-	ClientTime uint32 // This is but an echo of what was sent to the server
-	Options    uint32
+	ClientTime uint32 `ssc:"u32"` // This is but an echo of what was sent to the server
+	Options    uint32 `ssc:"u32"`
 
 	Lag uint32 // in milliseconds
 
@@ -41,8 +40,8 @@ func (p PingV2Resp) String() string {
 }
 
 type PingV2GlobalSummary struct {
-	Total   uint32
-	Playing uint32
+	Total   uint32 `ssc:"u32"`
+	Playing uint32 `ssc:"u32"`
 }
 
 func (g PingV2GlobalSummary) String() string {
@@ -50,9 +49,9 @@ func (g PingV2GlobalSummary) String() string {
 }
 
 type PingV2ArenaSummary struct {
-	Name    string
-	Total   uint16
-	Playing uint16
+	Name    string `ssc:"zstring=16"` // the size of the arena name field used by the game protocol
+	Total   uint16 `ssc:"u16"`
+	Playing uint16 `ssc:"u16"`
 }
 
 func (a PingV2ArenaSummary) String() string {
@@ -61,45 +60,32 @@ func (a PingV2ArenaSummary) String() string {
 
 var endian = binary.LittleEndian
 
-func PingV2(ip string, port int, debug bool, options uint32) (PingV2Resp, error) {
-	var resp PingV2Resp
-	addr := fmt.Sprintf("%s:%d", ip, port)
+// readTimeout is how long to wait for the server reply.
+const readTimeout = 5 * time.Second
 
-	conn, err := net.Dial("udp", addr)
-	if err != nil {
-		return resp, errors.Wrap(err, "net.Dial")
-	}
-	defer conn.Close()
+func PingV2(conn *server.Connection, options uint32) (PingV2Resp, error) {
+	var resp PingV2Resp
 
 	then := uint32(time.Now().UnixMilli())
 
-	C2SSimplePingV2 := make([]byte, 8)
-	endian.PutUint32(C2SSimplePingV2[0:4], then)
-	endian.PutUint32(C2SSimplePingV2[4:8], options)
+	out := bytestream.NewWriter(endian)
+	out.WriteUint32(then)
+	out.WriteUint32(options)
+	C2SSimplePingV2 := out.Bytes()
 
-	if debug {
-		logbytes.LogPrefix(C2SSimplePingV2, "C2S |")
-	}
 	if _, err := conn.Write(C2SSimplePingV2); err != nil {
 		return resp, errors.Wrap(err, "conn.Write")
 	}
 
-	respBytes := make([]byte, 2048)
-	n, err := conn.Read(respBytes)
+	respBytes, err := conn.ReadWithDeadline(readTimeout)
 	if err != nil {
-		return resp, errors.Wrap(err, "conn.Read")
-	}
-	if debug {
-		logbytes.LogPrefix(respBytes[:n], "S2C |")
+		return resp, errors.Wrap(err, "conn.ReadWithDeadline")
 	}
 
-	in := bytestream.New(respBytes[:n], endian)
+	in := bytestream.New(respBytes, endian)
 
-	if err := in.ReadUint32Var(&resp.ClientTime); err != nil {
-		return resp, errors.Wrap(err, "in.ReadUint32Var")
-	}
-	if err := in.ReadUint32Var(&resp.Options); err != nil {
-		return resp, errors.Wrap(err, "in.ReadUint32Var")
+	if err := bytestream.Unmarshal(in, &resp); err != nil {
+		return resp, errors.Wrap(err, "bytestream.Unmarshal")
 	}
 
 	now := uint32(time.Now().UnixMilli())
@@ -108,11 +94,8 @@ func PingV2(ip string, port int, debug bool, options uint32) (PingV2Resp, error)
 	// Global summary
 	if options&PingGlobalSummary != 0 {
 		var g PingV2GlobalSummary
-		if err := in.ReadUint32Var(&g.Total); err != nil {
-			return resp, errors.Wrap(err, "in.ReadUint32Var")
-		}
-		if err := in.ReadUint32Var(&g.Playing); err != nil {
-			return resp, errors.Wrap(err, "in.ReadUint32Var")
+		if err := bytestream.Unmarshal(in, &g); err != nil {
+			return resp, errors.Wrap(err, "bytestream.Unmarshal")
 		}
 
 		resp.GlobalSummary = &g
@@ -121,20 +104,18 @@ func PingV2(ip string, port int, debug bool, options uint32) (PingV2Resp, error)
 	// Arena summary
 	if options&PingArenaSummary != 0 {
 		for in.Len() > 0 {
-			var arena PingV2ArenaSummary
-			name, err := in.ReadZeroString()
+			// the list ends with an empty name
+			next, err := in.Peek(1)
 			if err != nil {
-				return resp, errors.Wrap(err, "ReadZeroString")
+				return resp, errors.Wrap(err, "in.Peek")
 			}
-			if name == "" {
+			if next[0] == 0 {
 				break
 			}
-			arena.Name = name
-			if err := in.ReadUint16Var(&arena.Total); err != nil {
-				return resp, errors.Wrap(err, "ReadUint16Var")
-			}
-			if err := in.ReadUint16Var(&arena.Playing); err != nil {
-				return resp, errors.Wrap(err, "ReadUint16Var")
+
+			var arena PingV2ArenaSummary
+			if err := bytestream.Unmarshal(in, &arena); err != nil {
+				return resp, errors.Wrap(err, "bytestream.Unmarshal")
 			}
 
 			resp.ArenaSummary = append(resp.ArenaSummary, arena)
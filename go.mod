@@ -1,6 +1,6 @@
 module github.com/ss-continuum/ssc
 
-go 1.17
+go 1.18
 
 require (
 	github.com/peterbourgon/ff/v3 v3.1.2
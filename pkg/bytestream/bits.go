@@ -0,0 +1,124 @@
+package bytestream
+
+import (
+	"github.com/pkg/errors"
+)
+
+// BitReader reads bit fields packed least significant bit first, as the game protocol does for weapon info,
+// ship status and position deltas. The first field of a byte sits in its lowest bits.
+type BitReader struct {
+	in *ByteStream
+
+	cur   byte
+	nbits int // unread bits left in cur
+}
+
+func NewBitReader(in *ByteStream) *BitReader {
+	return &BitReader{in: in}
+}
+
+// ReadBits reads an n bit unsigned field, 0 <= n <= 64. Bytes are pulled from the stream as needed.
+func (r *BitReader) ReadBits(n int) (uint64, error) {
+	if n < 0 || n > 64 {
+		return 0, errors.Errorf("cannot read %d bits", n)
+	}
+
+	var v uint64
+	for got := 0; got < n; {
+		if r.nbits == 0 {
+			c, err := r.in.ReadByte()
+			if err != nil {
+				return 0, errors.Wrap(err, "ReadByte")
+			}
+			r.cur, r.nbits = c, 8
+		}
+
+		take := n - got
+		if take > r.nbits {
+			take = r.nbits
+		}
+
+		v |= uint64(r.cur&(1<<take-1)) << got
+		r.cur >>= take
+		r.nbits -= take
+		got += take
+	}
+
+	return v, nil
+}
+
+// ReadSignedBits reads an n bit two's complement field.
+func (r *BitReader) ReadSignedBits(n int) (int64, error) {
+	v, err := r.ReadBits(n)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+
+	shift := 64 - n
+	return int64(v<<shift) >> shift, nil
+}
+
+func (r *BitReader) ReadBool() (bool, error) {
+	v, err := r.ReadBits(1)
+	return v == 1, err
+}
+
+// Align discards the unread bits of the current byte, so the next read starts on a byte boundary.
+func (r *BitReader) Align() {
+	r.cur, r.nbits = 0, 0
+}
+
+// BitWriter is the counterpart of BitReader. Bits are buffered until a byte is full; call Flush to write out
+// a trailing partial byte.
+type BitWriter struct {
+	out *Writer
+
+	cur   byte
+	nbits int // bits already used in cur
+}
+
+func NewBitWriter(out *Writer) *BitWriter {
+	return &BitWriter{out: out}
+}
+
+// WriteBits writes the low n bits of v, 0 <= n <= 64. Higher bits of v are ignored.
+func (w *BitWriter) WriteBits(v uint64, n int) error {
+	if n < 0 || n > 64 {
+		return errors.Errorf("cannot write %d bits", n)
+	}
+
+	for n > 0 {
+		take := 8 - w.nbits
+		if take > n {
+			take = n
+		}
+
+		w.cur |= byte(v&(1<<take-1)) << w.nbits
+		w.nbits += take
+		v >>= take
+		n -= take
+
+		if w.nbits == 8 {
+			w.out.WriteUint8(w.cur)
+			w.cur, w.nbits = 0, 0
+		}
+	}
+
+	return nil
+}
+
+func (w *BitWriter) WriteBool(b bool) {
+	if b {
+		_ = w.WriteBits(1, 1)
+	} else {
+		_ = w.WriteBits(0, 1)
+	}
+}
+
+// Flush writes the pending partial byte, padded with zero bits.
+func (w *BitWriter) Flush() {
+	if w.nbits > 0 {
+		w.out.WriteUint8(w.cur)
+		w.cur, w.nbits = 0, 0
+	}
+}
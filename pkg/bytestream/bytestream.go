@@ -3,17 +3,29 @@ package bytestream
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
+	"math"
+	"net/netip"
+
 	"github.com/pkg/errors"
 )
 
+// ByteStream decodes values from a byte slice, moving a cursor forward with every read.
+// Reads never copy or allocate, except when building strings.
 type ByteStream struct {
-	*bytes.Reader
+	data []byte
+	off  int
+	base int64 // offset of data inside the root stream, for error reporting
+
 	binary.ByteOrder
+
+	// Codec decodes strings read from the stream. Windows1252 is used when nil.
+	Codec Codec
 }
 
 func New(data []byte, endian binary.ByteOrder) *ByteStream {
 	r := ByteStream{
-		Reader:    bytes.NewReader(data),
+		data:      data,
 		ByteOrder: endian,
 	}
 
@@ -24,10 +36,154 @@ func New(data []byte, endian binary.ByteOrder) *ByteStream {
 	return &r
 }
 
+func (in *ByteStream) codec() Codec {
+	if in.Codec == nil {
+		return Windows1252
+	}
+	return in.Codec
+}
+
+// Len returns the number of unread bytes.
+func (in *ByteStream) Len() int {
+	return len(in.data) - in.off
+}
+
+// Remaining is an alias for Len.
+func (in *ByteStream) Remaining() int {
+	return in.Len()
+}
+
+// Offset returns the number of bytes already read from this stream.
+func (in *ByteStream) Offset() int {
+	return in.off
+}
+
+// Size returns the total length of the underlying data.
+func (in *ByteStream) Size() int64 {
+	return int64(len(in.data))
+}
+
+// next consumes exactly n bytes, or nothing at all when fewer than n are left.
+// The returned slice aliases the stream data.
+func (in *ByteStream) next(op string, n int) ([]byte, error) {
+	if in.Len() < n {
+		return nil, &DecodeError{Op: op, Offset: in.base + int64(in.off), Want: n, Remaining: in.Len()}
+	}
+
+	data := in.data[in.off : in.off+n]
+	in.off += n
+
+	return data, nil
+}
+
+// Sub consumes the next n bytes and returns them as a child stream with the same settings.
+// Reads from the child cannot go past those n bytes.
+func (in *ByteStream) Sub(n int) (*ByteStream, error) {
+	start := in.base + int64(in.off)
+	data, err := in.next("Sub", n)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ByteStream{
+		data:      data[:n:n],
+		base:      start,
+		ByteOrder: in.ByteOrder,
+		Codec:     in.Codec,
+	}, nil
+}
+
+// Peek returns the next n bytes without consuming them. The returned slice aliases the stream data.
+func (in *ByteStream) Peek(n int) ([]byte, error) {
+	if in.Len() < n {
+		return nil, &DecodeError{Op: "Peek", Offset: in.base + int64(in.off), Want: n, Remaining: in.Len()}
+	}
+
+	return in.data[in.off : in.off+n], nil
+}
+
+// Skip discards the next n bytes.
+func (in *ByteStream) Skip(n int) error {
+	_, err := in.next("Skip", n)
+	return err
+}
+
+// Read implements io.Reader.
+func (in *ByteStream) Read(b []byte) (int, error) {
+	if in.Len() == 0 {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+
+	n := copy(b, in.data[in.off:])
+	in.off += n
+
+	return n, nil
+}
+
+// ReadByte reads a single byte, failing with a *DecodeError at the end of the stream.
+func (in *ByteStream) ReadByte() (byte, error) {
+	if in.Len() < 1 {
+		return 0, &DecodeError{Op: "ReadByte", Offset: in.base + int64(in.off), Want: 1, Remaining: 0}
+	}
+
+	c := in.data[in.off]
+	in.off++
+
+	return c, nil
+}
+
+// ReadBytes reads exactly n bytes. The returned slice aliases the stream data and must not be modified.
+func (in *ByteStream) ReadBytes(n int) ([]byte, error) {
+	return in.next("ReadBytes", n)
+}
+
+func (in *ByteStream) ReadUint8() (uint8, error) {
+	data, err := in.next("ReadUint8", 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return data[0], nil
+}
+
+func (in *ByteStream) ReadUint8Var(out *uint8) error {
+	n, err := in.ReadUint8()
+	if err != nil {
+		return errors.Wrap(err, "ReadUint8")
+	}
+
+	*out = n
+
+	return nil
+}
+
+func (in *ByteStream) ReadUint16() (uint16, error) {
+	data, err := in.next("ReadUint16", 2)
+	if err != nil {
+		return 0, err
+	}
+
+	return in.ByteOrder.Uint16(data), nil
+}
+
+func (in *ByteStream) ReadUint16Var(out *uint16) error {
+	n, err := in.ReadUint16()
+	if err != nil {
+		return errors.Wrap(err, "ReadUint16")
+	}
+
+	*out = n
+
+	return nil
+}
+
 func (in *ByteStream) ReadUint32() (uint32, error) {
-	data := make([]byte, 4)
-	if _, err := in.Read(data); err != nil {
-		return 0, errors.Wrap(err, "in.Read")
+	data, err := in.next("ReadUint32", 4)
+	if err != nil {
+		return 0, err
 	}
 
 	return in.ByteOrder.Uint32(data), nil
@@ -44,19 +200,100 @@ func (in *ByteStream) ReadUint32Var(out *uint32) error {
 	return nil
 }
 
-func (in *ByteStream) ReadUint16() (uint16, error) {
-	data := make([]byte, 2)
-	if _, err := in.Read(data); err != nil {
-		return 0, errors.Wrap(err, "in.Read")
+func (in *ByteStream) ReadUint64() (uint64, error) {
+	data, err := in.next("ReadUint64", 8)
+	if err != nil {
+		return 0, err
 	}
 
-	return in.ByteOrder.Uint16(data), nil
+	return in.ByteOrder.Uint64(data), nil
 }
 
-func (in *ByteStream) ReadUint16Var(out *uint16) error {
+func (in *ByteStream) ReadUint64Var(out *uint64) error {
+	n, err := in.ReadUint64()
+	if err != nil {
+		return errors.Wrap(err, "ReadUint64")
+	}
+
+	*out = n
+
+	return nil
+}
+
+func (in *ByteStream) ReadInt8() (int8, error) {
+	n, err := in.ReadUint8()
+	return int8(n), err
+}
+
+func (in *ByteStream) ReadInt8Var(out *int8) error {
+	n, err := in.ReadInt8()
+	if err != nil {
+		return errors.Wrap(err, "ReadInt8")
+	}
+
+	*out = n
+
+	return nil
+}
+
+func (in *ByteStream) ReadInt16() (int16, error) {
 	n, err := in.ReadUint16()
+	return int16(n), err
+}
+
+func (in *ByteStream) ReadInt16Var(out *int16) error {
+	n, err := in.ReadInt16()
 	if err != nil {
-		return errors.Wrap(err, "ReadUint16")
+		return errors.Wrap(err, "ReadInt16")
+	}
+
+	*out = n
+
+	return nil
+}
+
+func (in *ByteStream) ReadInt32() (int32, error) {
+	n, err := in.ReadUint32()
+	return int32(n), err
+}
+
+func (in *ByteStream) ReadInt32Var(out *int32) error {
+	n, err := in.ReadInt32()
+	if err != nil {
+		return errors.Wrap(err, "ReadInt32")
+	}
+
+	*out = n
+
+	return nil
+}
+
+func (in *ByteStream) ReadInt64() (int64, error) {
+	n, err := in.ReadUint64()
+	return int64(n), err
+}
+
+func (in *ByteStream) ReadInt64Var(out *int64) error {
+	n, err := in.ReadInt64()
+	if err != nil {
+		return errors.Wrap(err, "ReadInt64")
+	}
+
+	*out = n
+
+	return nil
+}
+
+// ReadFloat32 reads an IEEE 754 single precision number.
+func (in *ByteStream) ReadFloat32() (float32, error) {
+	n, err := in.ReadUint32()
+	return math.Float32frombits(n), err
+}
+
+func (in *ByteStream) ReadFloat32Var(out *float32) error {
+	n, err := in.ReadFloat32()
+	if err != nil {
+		return errors.Wrap(err, "ReadFloat32")
 	}
 
 	*out = n
@@ -64,19 +301,94 @@ func (in *ByteStream) ReadUint16Var(out *uint16) error {
 	return nil
 }
 
+// ReadFloat64 reads an IEEE 754 double precision number.
+func (in *ByteStream) ReadFloat64() (float64, error) {
+	n, err := in.ReadUint64()
+	return math.Float64frombits(n), err
+}
+
+func (in *ByteStream) ReadFloat64Var(out *float64) error {
+	n, err := in.ReadFloat64()
+	if err != nil {
+		return errors.Wrap(err, "ReadFloat64")
+	}
+
+	*out = n
+
+	return nil
+}
+
+// ReadIPv4 reads a 4 byte address in network order, regardless of the stream byte order.
+func (in *ByteStream) ReadIPv4() (netip.Addr, error) {
+	data, err := in.next("ReadIPv4", 4)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	return netip.AddrFrom4([4]byte{data[0], data[1], data[2], data[3]}), nil
+}
+
+func (in *ByteStream) ReadIPv4Var(out *netip.Addr) error {
+	addr, err := in.ReadIPv4()
+	if err != nil {
+		return errors.Wrap(err, "ReadIPv4")
+	}
+
+	*out = addr
+
+	return nil
+}
+
 // ReadZeroString reads a zero-terminated string from the given reader.
+// When no terminator is found the stream is left untouched.
 func (in *ByteStream) ReadZeroString() (string, error) {
-	var ret string
-	var c byte
-	var err error
+	i := bytes.IndexByte(in.data[in.off:], 0)
+	if i < 0 {
+		return "", &DecodeError{Op: "ReadZeroString", Offset: in.base + int64(in.off), Want: in.Len() + 1, Remaining: in.Len()}
+	}
 
-	for c, err = in.ReadByte(); err == nil && c != 0; c, err = in.ReadByte() {
-		ret += string(c)
+	ret := in.codec().Decode(in.data[in.off : in.off+i])
+	in.off += i + 1
+
+	return ret, nil
+}
+
+// ReadZeroStringMax is ReadZeroString for strings of at most limit bytes, not counting the terminator.
+// Longer strings fail with ErrStringTooLong and leave the stream untouched. A negative limit is an error.
+func (in *ByteStream) ReadZeroStringMax(limit int) (string, error) {
+	if limit < 0 {
+		return "", errors.Errorf("negative string limit %d", limit)
 	}
 
-	if err != nil {
-		return "", errors.Wrap(err, "in.ReadByte")
+	window := in.data[in.off:]
+	if len(window) > limit+1 {
+		window = window[:limit+1]
 	}
 
+	i := bytes.IndexByte(window, 0)
+	if i < 0 {
+		if in.Len() <= limit {
+			return "", &DecodeError{Op: "ReadZeroStringMax", Offset: in.base + int64(in.off), Want: in.Len() + 1, Remaining: in.Len()}
+		}
+		return "", errors.Wrapf(ErrStringTooLong, "offset %d, limit %d", in.base+int64(in.off), limit)
+	}
+
+	ret := in.codec().Decode(window[:i])
+	in.off += i + 1
+
 	return ret, nil
 }
+
+// ReadFixedString reads a field of exactly n bytes and returns its contents up to the first zero byte.
+func (in *ByteStream) ReadFixedString(n int) (string, error) {
+	data, err := in.next("ReadFixedString", n)
+	if err != nil {
+		return "", err
+	}
+
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+
+	return in.codec().Decode(data), nil
+}
@@ -0,0 +1,237 @@
+package bytestream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// readerStream is the ByteStream before it moved to a byte slice with a cursor, kept to benchmark against.
+type readerStream struct {
+	*bytes.Reader
+	binary.ByteOrder
+}
+
+func newReaderStream(data []byte, endian binary.ByteOrder) *readerStream {
+	return &readerStream{Reader: bytes.NewReader(data), ByteOrder: endian}
+}
+
+func (in *readerStream) offset() int64 {
+	return in.Size() - int64(in.Len())
+}
+
+func (in *readerStream) next(op string, n int) ([]byte, error) {
+	if in.Len() < n {
+		return nil, &DecodeError{Op: op, Offset: in.offset(), Want: n, Remaining: in.Len()}
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(in.Reader, data); err != nil {
+		return nil, errors.Wrap(err, "io.ReadFull")
+	}
+
+	return data, nil
+}
+
+func (in *readerStream) ReadUint32() (uint32, error) {
+	data, err := in.next("ReadUint32", 4)
+	if err != nil {
+		return 0, err
+	}
+
+	return in.ByteOrder.Uint32(data), nil
+}
+
+func (in *readerStream) ReadUint16() (uint16, error) {
+	data, err := in.next("ReadUint16", 2)
+	if err != nil {
+		return 0, err
+	}
+
+	return in.ByteOrder.Uint16(data), nil
+}
+
+func (in *readerStream) ReadZeroString() (string, error) {
+	start := in.offset()
+	var ret string
+	var c byte
+	var err error
+
+	for c, err = in.Reader.ReadByte(); err == nil && c != 0; c, err = in.Reader.ReadByte() {
+		ret += string(c)
+	}
+
+	if err != nil {
+		if _, err := in.Seek(start, io.SeekStart); err != nil {
+			return "", errors.Wrap(err, "in.Seek")
+		}
+		return "", &DecodeError{Op: "ReadZeroString", Offset: start, Want: in.Len() + 1, Remaining: in.Len()}
+	}
+
+	return ret, nil
+}
+
+// recordReader is what both versions offer for decoding directory-like records.
+type recordReader interface {
+	ReadUint32() (uint32, error)
+	ReadUint16() (uint16, error)
+	ReadZeroString() (string, error)
+}
+
+// records returns n directory-like records: an address, a port, a player count and a description.
+func records(n int) []byte {
+	out := NewWriter(binary.LittleEndian)
+	for i := 0; i < n; i++ {
+		out.WriteUint32(0x04030201)
+		out.WriteUint16(5000)
+		out.WriteUint16(uint16(i))
+		out.WriteZeroString("A zone with a description of a typical length for the directory list")
+	}
+	return out.Bytes()
+}
+
+func decodeRecords(in recordReader, n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := in.ReadUint32(); err != nil {
+			return err
+		}
+		if _, err := in.ReadUint16(); err != nil {
+			return err
+		}
+		if _, err := in.ReadUint16(); err != nil {
+			return err
+		}
+		if _, err := in.ReadZeroString(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestDecodeRecords(t *testing.T) {
+	data := records(100)
+	for _, in := range []recordReader{New(data, nil), newReaderStream(data, binary.LittleEndian)} {
+		if err := decodeRecords(in, 100); err != nil {
+			t.Fatalf("%T: %v", in, err)
+		}
+	}
+}
+
+func BenchmarkDecodeRecords(b *testing.B) {
+	data := records(100)
+
+	b.Run("slice", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := decodeRecords(New(data, nil), 100); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("bytes.Reader", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := decodeRecords(newReaderStream(data, binary.LittleEndian), 100); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestFloat(t *testing.T) {
+	data := []byte{0x00, 0x00, 0xc0, 0x3f, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xc0}
+
+	in := New(data, binary.LittleEndian)
+	var f32 float32
+	var f64 float64
+	if err := in.ReadFloat32Var(&f32); err != nil || f32 != 1.5 {
+		t.Errorf("ReadFloat32Var = %v, %v, want 1.5", f32, err)
+	}
+	if err := in.ReadFloat64Var(&f64); err != nil || f64 != -2.25 {
+		t.Errorf("ReadFloat64Var = %v, %v, want -2.25", f64, err)
+	}
+	if _, err := in.ReadFloat32(); err == nil {
+		t.Error("ReadFloat32 past the end succeeded")
+	}
+
+	out := NewWriter(binary.LittleEndian)
+	out.WriteFloat32(1.5)
+	out.WriteFloat64(-2.25)
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("written % x, want % x", out.Bytes(), data)
+	}
+
+	type position struct {
+		X float32 `ssc:"f32"`
+		Y float64 `ssc:"f64"`
+	}
+	var p position
+	if err := Unmarshal(New(data, binary.LittleEndian), &p); err != nil || p.X != 1.5 || p.Y != -2.25 {
+		t.Fatalf("Unmarshal = %+v, %v", p, err)
+	}
+	marshaled, err := Marshal(&p)
+	if err != nil || !bytes.Equal(marshaled, data) {
+		t.Errorf("Marshal = % x, %v, want % x", marshaled, err, data)
+	}
+}
+
+func TestBits(t *testing.T) {
+	out := NewWriter(binary.LittleEndian)
+	w := NewBitWriter(out)
+	if err := w.WriteBits(0, 65); err == nil {
+		t.Error("WriteBits of 65 bits succeeded")
+	}
+	if err := w.WriteBits(0x5, 3); err != nil {
+		t.Fatal(err)
+	}
+	w.WriteBool(true)
+	if err := w.WriteBits(0x3ff, 10); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+
+	if want := []byte{0xfd, 0x3f}; !bytes.Equal(out.Bytes(), want) {
+		t.Fatalf("written % x, want % x", out.Bytes(), want)
+	}
+
+	r := NewBitReader(New(out.Bytes(), nil))
+	a, _ := r.ReadBits(3)
+	b, _ := r.ReadBool()
+	c, err := r.ReadBits(10)
+	if err != nil || a != 0x5 || !b || c != 0x3ff {
+		t.Errorf("read %#x %v %#x, %v", a, b, c, err)
+	}
+}
+
+func TestReadZeroStringMax(t *testing.T) {
+	tests := []struct {
+		data  string
+		limit int
+		want  string
+		err   error // the error expected when fail is set, nil for any
+		fail  bool
+	}{
+		{data: "abc\x00", limit: 3, want: "abc"},
+		{data: "abc\x00", limit: 10, want: "abc"},
+		{data: "\x00", limit: 0, want: ""},
+		{data: "abcd\x00", limit: 3, err: ErrStringTooLong, fail: true},
+		{data: "abc", limit: 3, err: io.ErrUnexpectedEOF, fail: true},
+		{data: "abc\x00", limit: -1, fail: true},
+		{data: "abc\x00", limit: -2, fail: true},
+	}
+
+	for _, tt := range tests {
+		in := New([]byte(tt.data), nil)
+		got, err := in.ReadZeroStringMax(tt.limit)
+		if (err != nil) != tt.fail || (tt.err != nil && !errors.Is(err, tt.err)) || got != tt.want {
+			t.Errorf("ReadZeroStringMax(%q, %d) = %q, %v", tt.data, tt.limit, got, err)
+		}
+		if tt.fail && in.Offset() != 0 {
+			t.Errorf("ReadZeroStringMax(%q, %d) consumed %d bytes", tt.data, tt.limit, in.Offset())
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package bytestream
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ErrStringTooLong is returned by ReadZeroStringMax when no terminator shows up within the limit.
+var ErrStringTooLong = errors.New("bytestream: zero-terminated string too long")
+
+// DecodeError is returned when a read needs more bytes than the stream has left.
+type DecodeError struct {
+	Op        string // the ByteStream method that failed
+	Offset    int64  // position where the read started, counted from the start of the root stream for sub-streams
+	Want      int    // bytes needed by the read
+	Remaining int    // bytes left in the stream
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("bytestream: %s at offset %d: need %d bytes, %d remaining", e.Op, e.Offset, e.Want, e.Remaining)
+}
+
+// Unwrap lets errors.Is(err, io.ErrUnexpectedEOF) match short reads.
+func (e *DecodeError) Unwrap() error {
+	return io.ErrUnexpectedEOF
+}
@@ -0,0 +1,444 @@
+package bytestream
+
+import (
+	"net"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Struct fields are mapped to their wire representation with the `ssc` tag:
+//
+//	u8, u16, u32, u64   unsigned integer of the given width
+//	i8, i16, i32, i64   signed integer of the given width
+//	f32, f64            IEEE 754 number of the given width
+//	fixed=N             N bytes stored in a string (cut at the first zero byte), a []byte or a [N]byte
+//	zstring             zero-terminated string
+//	zstring=N           zero-terminated string of at most N bytes before the terminator
+//	ipv4                4 byte address stored in a netip.Addr, a string, a net.IP or a [4]byte
+//	struct              nested struct, encoded with the same rules
+//
+// Fields are encoded in declaration order. Fields without a tag, or tagged with "-", are skipped.
+const tagName = "ssc"
+
+var addrType = reflect.TypeOf(netip.Addr{})
+
+type tagKind int
+
+const (
+	tagUint tagKind = iota
+	tagInt
+	tagFloat
+	tagFixed
+	tagZString
+	tagIPv4
+	tagStruct
+)
+
+type fieldTag struct {
+	kind tagKind
+	size int // width in bytes, or the length limit of a zstring (-1 when unlimited)
+}
+
+func parseTag(tag string) (fieldTag, error) {
+	switch tag {
+	case "u8":
+		return fieldTag{kind: tagUint, size: 1}, nil
+	case "u16":
+		return fieldTag{kind: tagUint, size: 2}, nil
+	case "u32":
+		return fieldTag{kind: tagUint, size: 4}, nil
+	case "u64":
+		return fieldTag{kind: tagUint, size: 8}, nil
+	case "i8":
+		return fieldTag{kind: tagInt, size: 1}, nil
+	case "i16":
+		return fieldTag{kind: tagInt, size: 2}, nil
+	case "i32":
+		return fieldTag{kind: tagInt, size: 4}, nil
+	case "i64":
+		return fieldTag{kind: tagInt, size: 8}, nil
+	case "f32":
+		return fieldTag{kind: tagFloat, size: 4}, nil
+	case "f64":
+		return fieldTag{kind: tagFloat, size: 8}, nil
+	case "zstring":
+		return fieldTag{kind: tagZString, size: -1}, nil
+	case "ipv4":
+		return fieldTag{kind: tagIPv4, size: 4}, nil
+	case "struct":
+		return fieldTag{kind: tagStruct}, nil
+	}
+
+	if strings.HasPrefix(tag, "zstring=") {
+		n, err := strconv.Atoi(strings.TrimPrefix(tag, "zstring="))
+		if err != nil || n < 0 {
+			return fieldTag{}, errors.Errorf("invalid string limit in tag %q", tag)
+		}
+		return fieldTag{kind: tagZString, size: n}, nil
+	}
+
+	if strings.HasPrefix(tag, "fixed=") {
+		n, err := strconv.Atoi(strings.TrimPrefix(tag, "fixed="))
+		if err != nil || n < 0 {
+			return fieldTag{}, errors.Errorf("invalid fixed size in tag %q", tag)
+		}
+		return fieldTag{kind: tagFixed, size: n}, nil
+	}
+
+	return fieldTag{}, errors.Errorf("unknown tag %q", tag)
+}
+
+// Unmarshal decodes the next bytes of in into the struct pointed to by v, following its `ssc` field tags.
+func Unmarshal(in *ByteStream, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.Errorf("Unmarshal needs a non-nil struct pointer, got %T", v)
+	}
+
+	return unmarshalStruct(in, rv.Elem())
+}
+
+// Marshal encodes the struct v (or the struct it points to) in little endian, following its `ssc` field tags.
+func Marshal(v interface{}) ([]byte, error) {
+	out := NewWriter(nil)
+	if err := MarshalTo(out, v); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// MarshalTo encodes the struct v (or the struct it points to) into out, following its `ssc` field tags.
+func MarshalTo(out *Writer, v interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return errors.Errorf("Marshal needs a struct, got %T", v)
+	}
+
+	return marshalStruct(out, rv)
+}
+
+func unmarshalStruct(in *ByteStream, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup(tagName)
+		if !ok || tag == "-" {
+			continue
+		}
+
+		ft, err := parseTag(tag)
+		if err != nil {
+			return errors.Wrapf(err, "field %s", sf.Name)
+		}
+		if !v.Field(i).CanSet() {
+			return errors.Errorf("field %s: cannot set unexported field", sf.Name)
+		}
+		if err := unmarshalField(in, ft, v.Field(i)); err != nil {
+			return errors.Wrapf(err, "field %s", sf.Name)
+		}
+	}
+
+	return nil
+}
+
+func unmarshalField(in *ByteStream, ft fieldTag, f reflect.Value) error {
+	switch ft.kind {
+	case tagUint:
+		if !isUint(f.Kind()) {
+			return errors.Errorf("unsigned integer tag on %s", f.Type())
+		}
+		n, err := readUint(in, ft.size)
+		if err != nil {
+			return err
+		}
+		if f.OverflowUint(n) {
+			return errors.Errorf("%d overflows %s", n, f.Type())
+		}
+		f.SetUint(n)
+
+	case tagInt:
+		if !isInt(f.Kind()) {
+			return errors.Errorf("signed integer tag on %s", f.Type())
+		}
+		u, err := readUint(in, ft.size)
+		if err != nil {
+			return err
+		}
+		n := signExtend(u, ft.size)
+		if f.OverflowInt(n) {
+			return errors.Errorf("%d overflows %s", n, f.Type())
+		}
+		f.SetInt(n)
+
+	case tagFloat:
+		if f.Kind() != reflect.Float32 && f.Kind() != reflect.Float64 {
+			return errors.Errorf("float tag on %s", f.Type())
+		}
+		if ft.size == 4 {
+			n, err := in.ReadFloat32()
+			if err != nil {
+				return errors.Wrap(err, "ReadFloat32")
+			}
+			f.SetFloat(float64(n))
+			return nil
+		}
+		n, err := in.ReadFloat64()
+		if err != nil {
+			return errors.Wrap(err, "ReadFloat64")
+		}
+		f.SetFloat(n)
+
+	case tagFixed:
+		if f.Kind() == reflect.String {
+			str, err := in.ReadFixedString(ft.size)
+			if err != nil {
+				return errors.Wrap(err, "ReadFixedString")
+			}
+			f.SetString(str)
+			return nil
+		}
+		data, err := in.ReadBytes(ft.size)
+		if err != nil {
+			return errors.Wrap(err, "ReadBytes")
+		}
+		return setBytes(f, data)
+
+	case tagIPv4:
+		addr, err := in.ReadIPv4()
+		if err != nil {
+			return errors.Wrap(err, "ReadIPv4")
+		}
+		switch {
+		case f.Type() == addrType:
+			f.Set(reflect.ValueOf(addr))
+		case f.Kind() == reflect.String:
+			f.SetString(addr.String())
+		default:
+			b := addr.As4()
+			return setBytes(f, b[:])
+		}
+
+	case tagZString:
+		if f.Kind() != reflect.String {
+			return errors.Errorf("zstring tag on %s", f.Type())
+		}
+		if ft.size < 0 {
+			s, err := in.ReadZeroString()
+			if err != nil {
+				return errors.Wrap(err, "ReadZeroString")
+			}
+			f.SetString(s)
+			return nil
+		}
+		s, err := in.ReadZeroStringMax(ft.size)
+		if err != nil {
+			return errors.Wrap(err, "ReadZeroStringMax")
+		}
+		f.SetString(s)
+
+	case tagStruct:
+		if f.Kind() != reflect.Struct {
+			return errors.Errorf("struct tag on %s", f.Type())
+		}
+		return unmarshalStruct(in, f)
+	}
+
+	return nil
+}
+
+func marshalStruct(out *Writer, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup(tagName)
+		if !ok || tag == "-" {
+			continue
+		}
+
+		ft, err := parseTag(tag)
+		if err != nil {
+			return errors.Wrapf(err, "field %s", sf.Name)
+		}
+		if !v.Field(i).CanInterface() {
+			return errors.Errorf("field %s: cannot read unexported field", sf.Name)
+		}
+		if err := marshalField(out, ft, v.Field(i)); err != nil {
+			return errors.Wrapf(err, "field %s", sf.Name)
+		}
+	}
+
+	return nil
+}
+
+func marshalField(out *Writer, ft fieldTag, f reflect.Value) error {
+	switch ft.kind {
+	case tagUint:
+		if !isUint(f.Kind()) {
+			return errors.Errorf("unsigned integer tag on %s", f.Type())
+		}
+		n := f.Uint()
+		if ft.size < 8 && n>>(8*ft.size) != 0 {
+			return errors.Errorf("%d does not fit in %d bytes", n, ft.size)
+		}
+		writeUint(out, n, ft.size)
+
+	case tagInt:
+		if !isInt(f.Kind()) {
+			return errors.Errorf("signed integer tag on %s", f.Type())
+		}
+		n := f.Int()
+		if signExtend(uint64(n), ft.size) != n {
+			return errors.Errorf("%d does not fit in %d bytes", n, ft.size)
+		}
+		writeUint(out, uint64(n), ft.size)
+
+	case tagFloat:
+		if f.Kind() != reflect.Float32 && f.Kind() != reflect.Float64 {
+			return errors.Errorf("float tag on %s", f.Type())
+		}
+		if ft.size == 4 {
+			out.WriteFloat32(float32(f.Float()))
+		} else {
+			out.WriteFloat64(f.Float())
+		}
+
+	case tagFixed:
+		if f.Kind() == reflect.String {
+			out.WriteFixedString(f.String(), ft.size)
+			return nil
+		}
+		data, err := getBytes(f)
+		if err != nil {
+			return err
+		}
+		if len(data) > ft.size {
+			data = data[:ft.size]
+		}
+		out.WriteBytes(data)
+		for i := len(data); i < ft.size; i++ {
+			out.WriteUint8(0)
+		}
+
+	case tagIPv4:
+		var ip net.IP
+		switch {
+		case f.Type() == addrType:
+			if addr := f.Interface().(netip.Addr); addr.IsValid() {
+				ip = addr.AsSlice()
+			}
+		case f.Kind() == reflect.String:
+			ip = net.ParseIP(f.String())
+		default:
+			data, err := getBytes(f)
+			if err != nil {
+				return err
+			}
+			ip = net.IP(data)
+		}
+		ip4 := ip.To4()
+		if ip4 == nil {
+			return errors.Errorf("%v is not an IPv4 address", f.Interface())
+		}
+		out.WriteBytes(ip4)
+
+	case tagZString:
+		if f.Kind() != reflect.String {
+			return errors.Errorf("zstring tag on %s", f.Type())
+		}
+		if ft.size >= 0 && len(out.codec().Encode(f.String())) > ft.size {
+			return errors.Errorf("string longer than %d bytes", ft.size)
+		}
+		out.WriteZeroString(f.String())
+
+	case tagStruct:
+		if f.Kind() != reflect.Struct {
+			return errors.Errorf("struct tag on %s", f.Type())
+		}
+		return marshalStruct(out, f)
+	}
+
+	return nil
+}
+
+func readUint(in *ByteStream, size int) (uint64, error) {
+	switch size {
+	case 1:
+		n, err := in.ReadUint8()
+		return uint64(n), errors.Wrap(err, "ReadUint8")
+	case 2:
+		n, err := in.ReadUint16()
+		return uint64(n), errors.Wrap(err, "ReadUint16")
+	case 4:
+		n, err := in.ReadUint32()
+		return uint64(n), errors.Wrap(err, "ReadUint32")
+	}
+
+	n, err := in.ReadUint64()
+	return n, errors.Wrap(err, "ReadUint64")
+}
+
+func writeUint(out *Writer, n uint64, size int) {
+	switch size {
+	case 1:
+		out.WriteUint8(uint8(n))
+	case 2:
+		out.WriteUint16(uint16(n))
+	case 4:
+		out.WriteUint32(uint32(n))
+	default:
+		out.WriteUint64(n)
+	}
+}
+
+func signExtend(n uint64, size int) int64 {
+	shift := 64 - 8*uint(size)
+	return int64(n<<shift) >> shift
+}
+
+// setBytes stores a copy of data in a []byte or byte array field.
+func setBytes(f reflect.Value, data []byte) error {
+	switch {
+	case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Uint8:
+		f.SetBytes(append([]byte(nil), data...))
+	case f.Kind() == reflect.Array && f.Type().Elem().Kind() == reflect.Uint8 && f.Len() == len(data):
+		reflect.Copy(f, reflect.ValueOf(data))
+	default:
+		return errors.Errorf("cannot store %d bytes in %s", len(data), f.Type())
+	}
+
+	return nil
+}
+
+func getBytes(f reflect.Value) ([]byte, error) {
+	switch {
+	case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Uint8:
+		return f.Bytes(), nil
+	case f.Kind() == reflect.Array && f.Type().Elem().Kind() == reflect.Uint8:
+		data := make([]byte, f.Len())
+		reflect.Copy(reflect.ValueOf(data), f)
+		return data, nil
+	}
+
+	return nil, errors.Errorf("cannot read bytes from %s", f.Type())
+}
+
+func isUint(k reflect.Kind) bool {
+	switch k {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		return true
+	}
+	return false
+}
+
+func isInt(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package bytestream
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestMarshalRoundTrip(t *testing.T) {
+	type inner struct {
+		B uint16 `ssc:"u16"`
+	}
+
+	tests := []struct {
+		name string
+		v    interface{} // pointer to the struct
+		data []byte
+	}{
+		{
+			name: "unsigned",
+			v: &struct {
+				A uint8  `ssc:"u8"`
+				B uint16 `ssc:"u16"`
+				C uint32 `ssc:"u32"`
+				D uint64 `ssc:"u64"`
+			}{1, 0x0203, 0x04050607, 8},
+			data: []byte{1, 3, 2, 7, 6, 5, 4, 8, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name: "signed",
+			v: &struct {
+				A int8  `ssc:"i8"`
+				B int16 `ssc:"i16"`
+				C int32 `ssc:"i32"`
+				D int64 `ssc:"i64"`
+			}{-1, -2, -3, -4},
+			data: []byte{0xff, 0xfe, 0xff, 0xfd, 0xff, 0xff, 0xff, 0xfc, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		},
+		{
+			name: "wider fields",
+			v: &struct {
+				A int  `ssc:"i8"`
+				B uint `ssc:"u16"`
+			}{-5, 7},
+			data: []byte{0xfb, 7, 0},
+		},
+		{
+			name: "floats",
+			v: &struct {
+				X float32 `ssc:"f32"`
+				Y float64 `ssc:"f64"`
+			}{1.5, -2.25},
+			data: []byte{0, 0, 0xc0, 0x3f, 0, 0, 0, 0, 0, 0, 0x02, 0xc0},
+		},
+		{
+			name: "fixed",
+			v: &struct {
+				S string  `ssc:"fixed=4"`
+				B []byte  `ssc:"fixed=3"`
+				A [2]byte `ssc:"fixed=2"`
+			}{"ab", []byte{1, 2, 3}, [2]byte{4, 5}},
+			data: []byte{'a', 'b', 0, 0, 1, 2, 3, 4, 5},
+		},
+		{
+			name: "zero strings",
+			v: &struct {
+				S string `ssc:"zstring"`
+				T string `ssc:"zstring=4"`
+			}{"hi", "abcd"},
+			data: []byte{'h', 'i', 0, 'a', 'b', 'c', 'd', 0},
+		},
+		{
+			name: "ipv4",
+			v: &struct {
+				A netip.Addr `ssc:"ipv4"`
+				S string     `ssc:"ipv4"`
+				I net.IP     `ssc:"ipv4"`
+				B [4]byte    `ssc:"ipv4"`
+			}{netip.MustParseAddr("10.0.0.1"), "10.0.0.2", net.IP{10, 0, 0, 3}, [4]byte{10, 0, 0, 4}},
+			data: []byte{10, 0, 0, 1, 10, 0, 0, 2, 10, 0, 0, 3, 10, 0, 0, 4},
+		},
+		{
+			name: "nested and skipped",
+			v: &struct {
+				A       uint8 `ssc:"u8"`
+				In      inner `ssc:"struct"`
+				skipped int
+				Dash    int `ssc:"-"`
+			}{A: 1, In: inner{0x0203}},
+			data: []byte{1, 3, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Marshal(tt.v)
+			if err != nil || !bytes.Equal(data, tt.data) {
+				t.Errorf("Marshal = % x, %v, want % x", data, err, tt.data)
+			}
+
+			in := New(tt.data, nil)
+			got := reflect.New(reflect.TypeOf(tt.v).Elem()).Interface()
+			if err := Unmarshal(in, got); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.v) {
+				t.Errorf("Unmarshal = %+v, want %+v", got, tt.v)
+			}
+			if in.Len() != 0 {
+				t.Errorf("%d bytes left", in.Len())
+			}
+		})
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"not a struct", 5},
+		{"unexported field", &struct {
+			a uint8 `ssc:"u8"`
+		}{1}},
+		{"unexported field by value", struct {
+			a [2]byte `ssc:"fixed=2"`
+		}{}},
+		{"unexported nested field", &struct {
+			In struct {
+				a net.IP `ssc:"ipv4"`
+			} `ssc:"struct"`
+		}{}},
+		{"unknown tag", &struct {
+			A uint8 `ssc:"u7"`
+		}{}},
+		{"bad fixed size", &struct {
+			A []byte `ssc:"fixed=x"`
+		}{}},
+		{"integer tag on a string", &struct {
+			A string `ssc:"u8"`
+		}{}},
+		{"unsigned too large", &struct {
+			A uint16 `ssc:"u8"`
+		}{256}},
+		{"signed too large", &struct {
+			A int16 `ssc:"i8"`
+		}{-129}},
+		{"float tag on an integer", &struct {
+			A int `ssc:"f32"`
+		}{}},
+		{"string too long", &struct {
+			S string `ssc:"zstring=2"`
+		}{"abc"}},
+		{"not an ipv4 address", &struct {
+			S string `ssc:"ipv4"`
+		}{"::1"}},
+	}
+
+	for _, tt := range tests {
+		if _, err := Marshal(tt.v); err == nil {
+			t.Errorf("%s: Marshal succeeded", tt.name)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		v    interface{}
+	}{
+		{"not a pointer", []byte{1}, struct {
+			A uint8 `ssc:"u8"`
+		}{}},
+		{"unexported field", []byte{1}, &struct {
+			a uint8 `ssc:"u8"`
+		}{}},
+		{"truncated", []byte{1}, &struct {
+			A uint16 `ssc:"u16"`
+		}{}},
+		{"overflow", []byte{0, 1}, &struct {
+			A uint8 `ssc:"u16"`
+		}{}},
+		{"string too long", []byte{'a', 'b', 'c', 0}, &struct {
+			S string `ssc:"zstring=2"`
+		}{}},
+		{"array of the wrong size", []byte{1, 2, 3}, &struct {
+			A [2]byte `ssc:"fixed=3"`
+		}{}},
+		{"float tag on an integer", []byte{0, 0, 0, 0}, &struct {
+			A int `ssc:"f32"`
+		}{}},
+	}
+
+	for _, tt := range tests {
+		if err := Unmarshal(New(tt.data, nil), tt.v); err == nil {
+			t.Errorf("%s: Unmarshal succeeded", tt.name)
+		}
+	}
+}
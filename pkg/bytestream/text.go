@@ -0,0 +1,115 @@
+package bytestream
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Codec converts text between its wire encoding and UTF-8.
+type Codec interface {
+	// Decode converts wire bytes to a UTF-8 string.
+	Decode(b []byte) string
+	// Encode converts a UTF-8 string to wire bytes, replacing runes the encoding cannot represent.
+	Encode(s string) []byte
+}
+
+// replacement is written in place of runes that cannot be encoded.
+const replacement = '?'
+
+var (
+	// Windows1252 is the encoding used by Subspace for zone names, arena names and chat. It is the default.
+	Windows1252 Codec = windows1252{}
+	// Latin1 maps every byte to the rune of the same value.
+	Latin1 Codec = latin1{}
+)
+
+// cp1252 holds the runes for bytes 0x80 to 0x9f, the only range where Windows-1252 differs from Latin-1.
+// Undefined positions keep their C1 control value so that every byte round-trips.
+var cp1252 = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡',
+	'ˆ', '‰', 'Š', '‹', 'Œ', '\u008d', 'Ž', '\u008f',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—',
+	'˜', '™', 'š', '›', 'œ', '\u009d', 'ž', 'Ÿ',
+}
+
+type windows1252 struct{}
+
+func (windows1252) Decode(b []byte) string {
+	if isASCII(b) {
+		return string(b)
+	}
+
+	var sb strings.Builder
+	sb.Grow(2 * len(b))
+	for _, c := range b {
+		if c >= 0x80 && c < 0xa0 {
+			sb.WriteRune(cp1252[c-0x80])
+		} else {
+			sb.WriteRune(rune(c))
+		}
+	}
+
+	return sb.String()
+}
+
+func (windows1252) Encode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			out = append(out, byte(r))
+		default:
+			out = append(out, encode1252(r))
+		}
+	}
+
+	return out
+}
+
+func encode1252(r rune) byte {
+	for i, c := range cp1252 {
+		if c == r {
+			return byte(0x80 + i)
+		}
+	}
+
+	return replacement
+}
+
+type latin1 struct{}
+
+func (latin1) Decode(b []byte) string {
+	if isASCII(b) {
+		return string(b)
+	}
+
+	var sb strings.Builder
+	sb.Grow(2 * len(b))
+	for _, c := range b {
+		sb.WriteRune(rune(c))
+	}
+
+	return sb.String()
+}
+
+func (latin1) Encode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			r = replacement
+		}
+		out = append(out, byte(r))
+	}
+
+	return out
+}
+
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,116 @@
+package bytestream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/netip"
+)
+
+// Writer is the encoding counterpart of ByteStream: it builds a packet in memory using the configured byte order.
+type Writer struct {
+	*bytes.Buffer
+	binary.ByteOrder
+
+	// Codec encodes strings written to the packet. Windows1252 is used when nil.
+	Codec Codec
+
+	scratch [8]byte
+}
+
+func NewWriter(endian binary.ByteOrder) *Writer {
+	w := Writer{
+		Buffer:    bytes.NewBuffer([]byte{}),
+		ByteOrder: endian,
+	}
+
+	if w.ByteOrder == nil {
+		w.ByteOrder = binary.LittleEndian
+	}
+
+	return &w
+}
+
+func (out *Writer) codec() Codec {
+	if out.Codec == nil {
+		return Windows1252
+	}
+	return out.Codec
+}
+
+func (out *Writer) WriteUint8(n uint8) {
+	out.Buffer.WriteByte(n)
+}
+
+func (out *Writer) WriteUint16(n uint16) {
+	out.ByteOrder.PutUint16(out.scratch[:2], n)
+	out.Buffer.Write(out.scratch[:2])
+}
+
+func (out *Writer) WriteUint32(n uint32) {
+	out.ByteOrder.PutUint32(out.scratch[:4], n)
+	out.Buffer.Write(out.scratch[:4])
+}
+
+func (out *Writer) WriteUint64(n uint64) {
+	out.ByteOrder.PutUint64(out.scratch[:8], n)
+	out.Buffer.Write(out.scratch[:8])
+}
+
+func (out *Writer) WriteInt8(n int8) {
+	out.WriteUint8(uint8(n))
+}
+
+func (out *Writer) WriteInt16(n int16) {
+	out.WriteUint16(uint16(n))
+}
+
+func (out *Writer) WriteInt32(n int32) {
+	out.WriteUint32(uint32(n))
+}
+
+func (out *Writer) WriteInt64(n int64) {
+	out.WriteUint64(uint64(n))
+}
+
+func (out *Writer) WriteFloat32(n float32) {
+	out.WriteUint32(math.Float32bits(n))
+}
+
+func (out *Writer) WriteFloat64(n float64) {
+	out.WriteUint64(math.Float64bits(n))
+}
+
+// WriteIPv4 writes addr in network order. Addresses that are not IPv4 are written as 0.0.0.0.
+func (out *Writer) WriteIPv4(addr netip.Addr) {
+	b := [4]byte{}
+	if addr.Is4() || addr.Is4In6() {
+		b = addr.Unmap().As4()
+	}
+	out.Buffer.Write(b[:])
+}
+
+// WriteBytes writes b as-is.
+func (out *Writer) WriteBytes(b []byte) {
+	out.Buffer.Write(b)
+}
+
+// WriteZeroString writes s followed by a zero terminator.
+func (out *Writer) WriteZeroString(s string) {
+	out.Buffer.Write(out.codec().Encode(s))
+	out.Buffer.WriteByte(0)
+}
+
+// WriteFixedString writes s into a field of exactly n bytes, truncating it or padding it with zeros as needed.
+// It is the counterpart of ByteStream.ReadFixedString.
+func (out *Writer) WriteFixedString(s string, n int) {
+	b := out.codec().Encode(s)
+	if len(b) > n {
+		b = b[:n]
+	}
+
+	out.Buffer.Write(b)
+	for i := len(b); i < n; i++ {
+		out.Buffer.WriteByte(0)
+	}
+}
@@ -1,7 +1,6 @@
 package directory
 
 import (
-	"bytes"
 	"encoding/binary"
 	"github.com/pkg/errors"
 	"github.com/ss-continuum/ssc/pkg/bytestream"
@@ -18,11 +17,11 @@ var endian = binary.LittleEndian
 type Connection struct {
 	*server.Connection
 
-	x08Map packetmap.PacketMap
-	x0aMap packetmap.PacketMap
+	chunks   *packetmap.Reassembler
+	received uint32 // reliable packets received, numbering them for chunks
 
-	x08ChunkComplete bool
-	x0aChunkComplete bool
+	payload  []byte // reassembled directory list
+	complete bool
 }
 
 func Dial(addr string) (*Connection, error) {
@@ -35,135 +34,91 @@ func Dial(addr string) (*Connection, error) {
 	}, nil
 }
 
-func (s *Connection) Login(key uint32) error {
-	out := bytes.NewBuffer([]byte{})
-	out.Write([]byte{0x00, 0x01})
+// handleReliable passes a reliable packet to the chunk reassembler. ReadPacket returns reliable packets in order,
+// but those unpacked from a reliable cluster share an id, so they are numbered here.
+func (s *Connection) handleReliable(p server.Packet) error {
+	seq := s.received
+	s.received++
 
-	uint32Bytes := make([]byte, 4)
-	// write key
-	endian.PutUint32(uint32Bytes, key)
-	out.Write(uint32Bytes)
-
-	// protocol version
-	out.Write([]byte{0x01, 0x00}) // vie
-	//out.Write([]byte{0x11, 0x00}) // continuum
-
-	_, err := s.Write(out.Bytes())
-	if err != nil {
-		return errors.Wrap(err, "failed to write login")
-	}
-
-	return nil
-}
-
-func (s *Connection) handleSmallChunk(id uint32, chunk []byte) {
-	s.x08Map.Add(id, chunk)
-
-	if chunk[0] == 0x00 && chunk[1] == 0x09 {
-		s.x08ChunkComplete = true
-	}
-}
-
-func (s *Connection) handleBigChunk(id uint32, chunk []byte) {
-	s.x0aMap.Add(id, chunk)
-
-	expectedLen := int(endian.Uint32(chunk[2:6]))
-
-	if s.x0aMap.Size() >= expectedLen {
-		s.x0aChunkComplete = true
-	}
-}
-
-func (s *Connection) handle0x03(data []byte) error {
-	packetID := endian.Uint32(data[2:6])
-	packetData := data[6:]
-
-	if err := s.Ack(packetID); err != nil {
-		return errors.Errorf("cannot ack packet %d", packetID)
+	if !packetmap.IsChunk(p.Data) {
+		if err := s.chunks.Skip(seq); err != nil {
+			return errors.Wrap(err, "s.chunks.Skip")
+		}
+		return errors.Errorf("I don't know what to do with reliable packet %d: % x", p.ID, p.Data)
 	}
 
-	if packetData[0] == 0x00 && (packetData[1] == 0x08 || packetData[1] == 0x09) {
-		s.handleSmallChunk(packetID, packetData)
-	} else if packetData[0] == 0x00 && packetData[1] == 0x0a {
-		s.handleBigChunk(packetID, packetData)
-	} else {
-		return errors.Errorf("I don't know what to do with packet 0x%02x 0x%02x inside a 0x00 0x03 packet\n", packetData[0], packetData[1])
+	if err := s.chunks.Add(seq, p.Data); err != nil {
+		return errors.Wrap(err, "s.chunks.Add")
 	}
 
 	return nil
 }
 
 func (s *Connection) RequestList(minPlayers uint32) error {
-	payload := []byte{
-		0x00, 0x03,
-		0, 0, 0, 0, 0x01,
-		0, 0, 0, 0,
-	}
-	endian.PutUint32(payload[7:11], minPlayers)
+	out := bytestream.NewWriter(endian)
+	out.WriteUint8(0x01)
+	out.WriteUint32(minPlayers)
 
-	if _, err := s.Write(payload); err != nil {
-		return errors.Wrap(err, "s.Write")
+	if err := s.SendReliable(out.Bytes()); err != nil {
+		return errors.Wrap(err, "s.SendReliable")
 	}
 
 	return nil
 }
 
 func (s *Connection) Directory(minPlayers uint32) (directory.Directory, error) {
-	s.x08Map = packetmap.New()
-	s.x0aMap = packetmap.New()
+	s.chunks = packetmap.NewReassembler(func(data []byte) error {
+		// the list is the first message, anything after it is left alone
+		if !s.complete {
+			s.payload, s.complete = data, true
+		}
+		return nil
+	})
+	s.payload, s.complete, s.received = nil, false, 0
 
 	var ret directory.Directory
 	timeoutCount := 0
 
 	for {
-		data, err := s.ReadWithDeadline(5 * time.Second)
+		p, err := s.ReadPacket(5 * time.Second)
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				return ret, errors.Wrap(err, "conn.ReadWithDeadline")
+			var reliableErr *server.ReliableError
+			if errors.Is(err, io.EOF) || errors.As(err, &reliableErr) {
+				return ret, errors.Wrap(err, "conn.ReadPacket")
 			}
 			log.Println(err)
 			timeoutCount++
 
 			if timeoutCount >= 5 {
+				if missing := s.MissingReliable(); len(missing) > 0 {
+					return ret, errors.Errorf("timeout x 5, %d reliable packets missing, first %d", len(missing), missing[0])
+				}
 				return ret, errors.New("timeout x 5")
 			}
 
 			continue
 		}
 
-		if data[0] == 0x00 && data[1] == 0x02 {
+		data := p.Data
+		if p.Reliable {
+			if err := s.handleReliable(p); err != nil {
+				log.Println(err)
+			}
+		} else if len(data) >= 2 && data[0] == 0x00 && data[1] == 0x02 {
 			if err := s.RequestList(minPlayers); err != nil {
 				return directory.Directory{}, errors.Wrap(err, "s.RequestList")
 			}
+		} else if len(data) >= 2 && data[0] == 0x00 && data[1] == 0x07 {
+			return ret, errors.New("server requested disconnection")
 		}
 
-		if data[0] == 0x00 && data[1] == 0x03 {
-			if err := s.handle0x03(data); err != nil {
-				log.Println(err)
-				//return ret, errors.Wrap(err, "failed to handle 0x03 packet")
-			}
-		}
-
-		if s.x08ChunkComplete || s.x0aChunkComplete {
+		if s.complete {
 			_ = s.Disconnect()
 			break
 		}
-
-		if data[0] == 0x00 && data[1] == 0x07 {
-			return ret, errors.New("server requested disconnection")
-		}
-	}
-
-	var consolidatedData []byte
-	if s.x08ChunkComplete {
-		consolidatedData = s.x08Map.Bytes()
-		s.x08Map.Clear()
-	} else if s.x0aChunkComplete {
-		consolidatedData = s.x0aMap.Bytes()
-		s.x0aMap.Clear()
 	}
 
-	entryList, err := directory.NewFromStream(bytestream.New(consolidatedData, endian))
+	entryList, err := directory.NewFromStream(bytestream.New(s.payload, endian))
 	if err != nil {
 		log.Println("decodeDirectoryPayload:", err)
 	}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ss-continuum/ssc/pkg/packetmap"
+)
+
+// maxClustered is the largest packet that fits in a cluster, whose length prefix is a single byte.
+const maxClustered = 255
+
+// Unpack returns the packets carried by a datagram: the datagram itself, or the packets bundled in a 0x00 0x0e
+// cluster, looking into nested clusters. A truncated entry ends the cluster.
+func Unpack(b []byte) [][]byte {
+	if len(b) < 2 || b[0] != 0x00 || b[1] != 0x0e {
+		return [][]byte{b}
+	}
+
+	var packets [][]byte
+	for rest := b[2:]; len(rest) > 0; {
+		n := int(rest[0])
+		if n == 0 || 1+n > len(rest) {
+			break
+		}
+		packets = append(packets, Unpack(rest[1:1+n])...)
+		rest = rest[1+n:]
+	}
+
+	return packets
+}
+
+// batch holds small packets waiting to be sent together.
+type batch struct {
+	packets [][]byte
+	size    int       // size of the cluster they make
+	due     time.Time // time the batch is sent
+}
+
+// WriteBatched sends a small packet, such as an ack, bundled with the others sent within ClusterWindow in a
+// 0x00 0x0e cluster. Without ClusterWindow, or for packets too large to be clustered, it is the same as Write.
+func (s *Connection) WriteBatched(b []byte) error {
+	if s.ClusterWindow <= 0 || len(b) > maxClustered {
+		_, err := s.Write(b)
+		return errors.Wrap(err, "s.Write")
+	}
+
+	if s.batch.size+1+len(b) > packetmap.MaxPacketSize {
+		if err := s.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(s.batch.packets) == 0 {
+		s.batch.size = 2
+		s.batch.due = time.Now().Add(s.ClusterWindow)
+	}
+	s.batch.packets = append(s.batch.packets, append([]byte(nil), b...))
+	s.batch.size += 1 + len(b)
+
+	return nil
+}
+
+// Flush sends the packets batched by WriteBatched right away.
+func (s *Connection) Flush() error {
+	packets := s.batch.packets
+	s.batch = batch{}
+
+	switch len(packets) {
+	case 0:
+		return nil
+	case 1:
+		_, err := s.Write(packets[0])
+		return errors.Wrap(err, "s.Write")
+	}
+
+	cluster := make([]byte, 2, packetmap.MaxPacketSize)
+	cluster[1] = 0x0e
+	for _, p := range packets {
+		cluster = append(cluster, byte(len(p)))
+		cluster = append(cluster, p...)
+	}
+
+	_, err := s.Write(cluster)
+	return errors.Wrap(err, "s.Write")
+}
+
+// flushDue sends the batch when its window is over.
+func (s *Connection) flushDue(now time.Time) error {
+	if len(s.batch.packets) == 0 || now.Before(s.batch.due) {
+		return nil
+	}
+	return s.Flush()
+}
+
+// nextFlush returns the time the batch is due.
+func (s *Connection) nextFlush() (time.Time, bool) {
+	return s.batch.due, len(s.batch.packets) > 0
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestUnpack(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want [][]byte
+	}{
+		{"not a cluster", []byte{0x00, 0x04, 1, 0, 0, 0}, [][]byte{{0x00, 0x04, 1, 0, 0, 0}}},
+		{"empty cluster", []byte{0x00, 0x0e}, nil},
+		{"two packets", []byte{0x00, 0x0e, 2, 0x03, 'a', 1, 0x04}, [][]byte{{0x03, 'a'}, {0x04}}},
+		{"nested", []byte{0x00, 0x0e, 5, 0x00, 0x0e, 2, 0x03, 'a', 1, 0x04}, [][]byte{{0x03, 'a'}, {0x04}}},
+		{"truncated entry", []byte{0x00, 0x0e, 2, 0x03, 'a', 5, 0x04, 'b'}, [][]byte{{0x03, 'a'}}},
+		{"zero length entry", []byte{0x00, 0x0e, 0, 2, 0x03, 'a'}, nil},
+		{"truncated nested", []byte{0x00, 0x0e, 4, 0x00, 0x0e, 3, 0x03}, nil},
+	}
+
+	for _, tt := range tests {
+		got := Unpack(tt.in)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: Unpack = % x, want % x", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if !bytes.Equal(got[i], tt.want[i]) {
+				t.Errorf("%s: Unpack = % x, want % x", tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestWriteBatched(t *testing.T) {
+	s, peer := newTestConn(t)
+	s.ClusterWindow = time.Hour
+
+	// 2 bytes of cluster header, then 1 + 100 per packet: the sixth would make 608 bytes
+	packet := bytes.Repeat([]byte{0x03}, 100)
+	for i := 0; i < 6; i++ {
+		if err := s.WriteBatched(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := received(t, peer)
+	if len(got) != 1 || len(got[0]) != 2+5*101 || len(Unpack(got[0])) != 5 {
+		t.Fatalf("got %d datagrams, want one cluster of 5 packets", len(got))
+	}
+
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := received(t, peer); len(got) != 1 || !bytes.Equal(got[0], packet) {
+		t.Errorf("a batch of one was not sent as a plain packet: % x", got)
+	}
+
+	if err := s.WriteBatched(make([]byte, 300)); err != nil {
+		t.Fatal(err)
+	}
+	if got := received(t, peer); len(got) != 1 || len(got[0]) != 300 {
+		t.Errorf("a packet too large for a cluster was not sent right away")
+	}
+}
+
+func TestReceiveCluster(t *testing.T) {
+	s, _ := newTestConn(t)
+
+	_ = s.receive(reliablePacket(1, 0x00, 0x0e, 2, 'b', '1', 3, 0x00, 0x08, 'x'))
+	_ = s.receive(reliablePacket(0, 'a'))
+
+	want := []Packet{
+		{Data: []byte("a"), Reliable: true, ID: 0},
+		{Data: []byte("b1"), Reliable: true, ID: 1},
+		{Data: []byte{0x00, 0x08, 'x'}, Reliable: true, ID: 1},
+	}
+	if len(s.queue) != len(want) {
+		t.Fatalf("queued %d packets, want %d: %v", len(s.queue), len(want), s.queue)
+	}
+	for i, p := range s.queue {
+		if !bytes.Equal(p.Data, want[i].Data) || p.Reliable != want[i].Reliable || p.ID != want[i].ID {
+			t.Errorf("packet %d = %+v, want %+v", i, p, want[i])
+		}
+	}
+}
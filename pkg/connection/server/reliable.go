@@ -0,0 +1,205 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ss-continuum/ssc/pkg/bytestream"
+)
+
+// DefaultMaxAttempts is the number of times a reliable packet is sent when MaxAttempts is not set.
+const DefaultMaxAttempts = 5
+
+// DefaultSendWindow is the window of reliable packets sent ahead when SendWindow is not set. A receiver drops the
+// packets further ahead than its own window without acking them, and ReadPacket buffers maxWindow.
+const DefaultSendWindow = maxWindow
+
+// Bounds of the retransmission timeout.
+const (
+	initialRTO = 500 * time.Millisecond
+	minRTO     = 100 * time.Millisecond
+	maxRTO     = 5 * time.Second
+)
+
+// ReliableError is returned when a reliable packet was never acked.
+type ReliableError struct {
+	ID       uint32
+	Attempts int
+}
+
+func (e *ReliableError) Error() string {
+	return fmt.Sprintf("reliable packet %d not acked after %d attempts", e.ID, e.Attempts)
+}
+
+// reliable is a reliable packet waiting for its ack.
+type reliable struct {
+	id       uint32
+	packet   []byte
+	sent     time.Time // time of the last attempt
+	due      time.Time // time of the next attempt
+	attempts int
+}
+
+// rttEstimator smooths round trip samples to derive the retransmission timeout, as TCP does (RFC 6298).
+type rttEstimator struct {
+	srtt, rttvar time.Duration
+	samples      int
+}
+
+func (e *rttEstimator) add(sample time.Duration) {
+	if e.samples == 0 {
+		e.srtt, e.rttvar = sample, sample/2
+	} else {
+		diff := e.srtt - sample
+		if diff < 0 {
+			diff = -diff
+		}
+		e.rttvar = (3*e.rttvar + diff) / 4
+		e.srtt = (7*e.srtt + sample) / 8
+	}
+	e.samples++
+}
+
+func (e *rttEstimator) rto() time.Duration {
+	if e.samples == 0 {
+		return initialRTO
+	}
+
+	rto := e.srtt + 4*e.rttvar
+	if rto < minRTO {
+		return minRTO
+	}
+	if rto > maxRTO {
+		return maxRTO
+	}
+	return rto
+}
+
+func (s *Connection) sendWindow() uint32 {
+	if s.SendWindow <= 0 {
+		return DefaultSendWindow
+	}
+	return uint32(s.SendWindow)
+}
+
+func (s *Connection) maxAttempts() int {
+	if s.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return s.MaxAttempts
+}
+
+// RTT returns the smoothed round trip time measured from acks, or zero before the first one.
+func (s *Connection) RTT() time.Duration {
+	return s.rtt.srtt
+}
+
+// Unacked returns the number of reliable packets still waiting for their ack.
+func (s *Connection) Unacked() int {
+	return len(s.unacked)
+}
+
+// SendReliable sends payload in a 0x00 0x03 reliable packet with the next reliable id. The packet is sent again
+// from ReadWithDeadline until its ack arrives. When the send window is full, it first reads until the acks make
+// room; the packets that arrive meanwhile are kept for ReadPacket.
+func (s *Connection) SendReliable(payload []byte) error {
+	if err := s.waitWindow(); err != nil {
+		return err
+	}
+
+	out := bytestream.NewWriter(endian)
+	out.WriteBytes([]byte{0x00, 0x03})
+	out.WriteUint32(s.nextReliable)
+	out.WriteBytes(payload)
+
+	if _, err := s.Write(out.Bytes()); err != nil {
+		return errors.Wrap(err, "s.Write")
+	}
+
+	now := time.Now()
+	s.unacked = append(s.unacked, &reliable{
+		id:       s.nextReliable,
+		packet:   out.Bytes(),
+		sent:     now,
+		due:      now.Add(s.rtt.rto()),
+		attempts: 1,
+	})
+	s.nextReliable++
+
+	return nil
+}
+
+// waitWindow reads until the reliable packet to send next is within SendWindow of the oldest one not acked.
+func (s *Connection) waitWindow() error {
+	for len(s.unacked) > 0 && s.nextReliable-s.unacked[0].id >= s.sendWindow() {
+		err := s.readPacket(maxRTO)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			continue // retransmissions go on until the acks arrive or MaxAttempts is reached
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// acked forgets the reliable packet id. Only packets acked after their first attempt give a round trip sample,
+// since the ack of a retransmitted packet cannot be matched to an attempt.
+func (s *Connection) acked(id uint32, now time.Time) {
+	for i, r := range s.unacked {
+		if r.id != id {
+			continue
+		}
+
+		if r.attempts == 1 {
+			s.rtt.add(now.Sub(r.sent))
+		}
+		s.unacked = append(s.unacked[:i], s.unacked[i+1:]...)
+		return
+	}
+}
+
+// nextRetransmit returns the time the next retransmission is due.
+func (s *Connection) nextRetransmit() (time.Time, bool) {
+	var due time.Time
+	for _, r := range s.unacked {
+		if due.IsZero() || r.due.Before(due) {
+			due = r.due
+		}
+	}
+	return due, !due.IsZero()
+}
+
+// retransmit sends again the reliable packets that are due, backing off exponentially. A packet that used up
+// its attempts is dropped and reported.
+func (s *Connection) retransmit(now time.Time) error {
+	for i := 0; i < len(s.unacked); i++ {
+		r := s.unacked[i]
+		if now.Before(r.due) {
+			continue
+		}
+
+		if r.attempts >= s.maxAttempts() {
+			s.unacked = append(s.unacked[:i], s.unacked[i+1:]...)
+			return &ReliableError{ID: r.id, Attempts: r.attempts}
+		}
+
+		if _, err := s.Write(r.packet); err != nil {
+			return errors.Wrap(err, "s.Write")
+		}
+
+		// clamped before the shift, which overflows past a few dozen attempts
+		backoff := maxRTO
+		if rto := s.rtt.rto(); r.attempts < 16 && rto<<r.attempts < maxRTO {
+			backoff = rto << r.attempts
+		}
+		r.sent, r.due = now, now.Add(backoff)
+		r.attempts++
+	}
+
+	return nil
+}
@@ -1,10 +1,13 @@
 package server
 
 import (
-	"bytes"
 	"encoding/binary"
 	"github.com/pkg/errors"
+	"github.com/ss-continuum/ssc/pkg/bytestream"
 	"github.com/ss-continuum/ssc/pkg/logbytes"
+	"github.com/ss-continuum/ssc/pkg/packetmap"
+	"github.com/ss-continuum/ssc/pkg/pcapng"
+	"github.com/ss-continuum/ssc/pkg/vie"
 	"log"
 	"net"
 	"time"
@@ -15,7 +18,39 @@ var endian = binary.LittleEndian
 // Connection is a helper struct for handling udp connections to ssc ping, directory, billing and game servers.
 type Connection struct {
 	net.Conn
-	Debug bool
+
+	// Debug, when set, receives every datagram sent and received, before encryption.
+	Debug logbytes.PacketLogger
+	// Capture, when set, records every datagram sent and received, before encryption.
+	Capture *pcapng.Writer
+
+	// Raw turns off the core protocol, for servers that do not speak it such as ping servers: ReadWithDeadline
+	// returns datagrams without looking for acks, sync packets, clusters or the encryption response in them.
+	Raw bool
+	// SyncInterval, when set, is how often ReadWithDeadline sends a sync request to measure the server clock.
+	SyncInterval time.Duration
+	// ClusterWindow, when set, is how long WriteBatched holds small packets, acks included, to bundle them in
+	// a cluster.
+	ClusterWindow time.Duration
+	// MaxAttempts is the number of times a reliable packet is sent before giving up. DefaultMaxAttempts when zero.
+	MaxAttempts int
+	// SendWindow is the most reliable packets sent past the oldest one waiting for its ack. DefaultSendWindow
+	// when zero.
+	SendWindow int
+
+	nextReliable uint32      // id of the next reliable packet sent
+	unacked      []*reliable // reliable packets waiting for their ack, in id order
+	rtt          rttEstimator
+
+	nextIncoming uint32            // id of the next reliable packet to deliver
+	incoming     map[uint32][]byte // reliable payloads received ahead of nextIncoming
+	queue        []Packet          // packets ready for ReadPacket
+
+	sync  syncState
+	batch batch
+
+	clientKey uint32      // key sent by Login
+	cipher    *vie.Cipher // set once the server agreed to encrypt
 }
 
 // Dial -- connect to addr in the format ip:port
@@ -32,24 +67,74 @@ func Dial(addr string) (*Connection, error) {
 }
 
 func (s *Connection) Write(b []byte) (int, error) {
-	if s.Debug {
-		logbytes.LogPrefix(b, "C2S |")
+	if s.Debug != nil {
+		s.Debug.DumpPrefix(b, logbytes.ClientToServer)
+	}
+	s.capture(pcapng.Outbound, b)
+	s.sync.stats.Sent++
+
+	if s.cipher == nil {
+		return s.Conn.Write(b)
 	}
-	return s.Conn.Write(b)
+
+	// b is left alone, reliable packets are kept for retransmission
+	enc := append([]byte(nil), b...)
+	if err := s.cipher.Encrypt(enc); err != nil {
+		return 0, errors.Wrap(err, "cipher.Encrypt")
+	}
+	return s.Conn.Write(enc)
+}
+
+// Encrypted tells whether the server agreed to encrypt the session.
+func (s *Connection) Encrypted() bool {
+	return s.cipher != nil
 }
 
+// handleKey sets up encryption from the server key of a 0x00 0x02 encryption response.
+func (s *Connection) handleKey(data []byte) {
+	if s.cipher != nil || len(data) < 6 || data[0] != 0x00 || data[1] != 0x02 {
+		return
+	}
+
+	serverKey := endian.Uint32(data[2:6])
+	if s.clientKey != 0 && vie.Enabled(s.clientKey, serverKey) {
+		s.cipher = vie.NewCipher(serverKey)
+	}
+}
+
+func (s *Connection) capture(dir pcapng.Direction, b []byte) {
+	if s.Capture == nil {
+		return
+	}
+
+	local, _ := s.LocalAddr().(*net.UDPAddr)
+	remote, _ := s.RemoteAddr().(*net.UDPAddr)
+	if local == nil || remote == nil {
+		return
+	}
+
+	src, dst := local.AddrPort(), remote.AddrPort()
+	if dir == pcapng.Inbound {
+		src, dst = dst, src
+	}
+
+	if err := s.Capture.WritePacket(time.Now(), src, dst, dir, b); err != nil {
+		log.Println("capture:", err)
+	}
+}
+
+// Login sends the 0x00 0x01 encryption request. A zero key asks for no encryption; a key from vie.GenerateKey
+// lets the server pick one, after which every datagram is encrypted and decrypted transparently.
 func (s *Connection) Login(key uint32) error {
-	out := bytes.NewBuffer([]byte{})
-	out.Write([]byte{0x00, 0x01})
+	s.clientKey, s.cipher = key, nil
 
-	uint32Bytes := make([]byte, 4)
-	// write key
-	endian.PutUint32(uint32Bytes, key)
-	out.Write(uint32Bytes)
+	out := bytestream.NewWriter(endian)
+	out.WriteBytes([]byte{0x00, 0x01})
+	out.WriteUint32(key)
 
 	// protocol version
-	out.Write([]byte{0x01, 0x00}) // vie
-	//out.Write([]byte{0x11, 0x00}) // continuum
+	out.WriteUint16(0x0001) // vie
+	//out.WriteUint16(0x0011) // continuum
 
 	_, err := s.Write(out.Bytes())
 	if err != nil {
@@ -60,15 +145,11 @@ func (s *Connection) Login(key uint32) error {
 }
 
 func (s *Connection) Ack(packetID uint32) error {
-	out := bytes.NewBuffer([]byte{})
-	out.Write([]byte{0x00, 0x04})
+	out := bytestream.NewWriter(endian)
+	out.WriteBytes([]byte{0x00, 0x04})
+	out.WriteUint32(packetID)
 
-	uint32Bytes := make([]byte, 4)
-	// write key
-	endian.PutUint32(uint32Bytes, packetID)
-	out.Write(uint32Bytes)
-
-	_, err := s.Write(out.Bytes())
+	err := s.WriteBatched(out.Bytes())
 	if err != nil {
 		return errors.Wrap(err, "failed to write ack")
 	}
@@ -76,7 +157,39 @@ func (s *Connection) Ack(packetID uint32) error {
 	return nil
 }
 
+// SendChunked sends data as 0x00 0x08 fragments ended by a 0x00 0x09 tail, each in a reliable packet.
+func (s *Connection) SendChunked(data []byte) error {
+	for _, fragment := range packetmap.Fragment(data, 0) {
+		if err := s.SendReliable(fragment); err != nil {
+			return errors.Wrap(err, "s.SendReliable")
+		}
+	}
+
+	return nil
+}
+
+// SendBigChunked sends data as 0x00 0x0a fragments, each in a reliable packet. It suits large transfers such as
+// map files: no more than SendWindow fragments are sent ahead of the acks.
+func (s *Connection) SendBigChunked(data []byte) error {
+	fragments, err := packetmap.FragmentBig(data, 0)
+	if err != nil {
+		return errors.Wrap(err, "packetmap.FragmentBig")
+	}
+
+	for _, fragment := range fragments {
+		if err := s.SendReliable(fragment); err != nil {
+			return errors.Wrap(err, "s.SendReliable")
+		}
+	}
+
+	return nil
+}
+
 func (s *Connection) Disconnect() error {
+	if err := s.Flush(); err != nil {
+		return errors.Wrap(err, "s.Flush")
+	}
+
 	payload := []byte{
 		0x00, 0x07,
 	}
@@ -89,22 +202,81 @@ func (s *Connection) Disconnect() error {
 	return nil
 }
 
+// ReadWithDeadline returns the next datagram received within duration. While it waits, reliable packets whose
+// ack is late are sent again, and sync requests are sent every SyncInterval. Acks are matched against the
+// reliable packets sent and sync packets are handled, inside clusters too, and both are returned like any other
+// datagram. Packets batched by WriteBatched are sent when their window is over.
+// A *ReliableError is returned when a reliable packet was sent MaxAttempts times without an ack.
 func (s *Connection) ReadWithDeadline(duration time.Duration) ([]byte, error) {
-	err := s.SetReadDeadline(time.Now().Add(duration))
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to set read deadline")
-	}
-
+	deadline := time.Now().Add(duration)
 	buf := make([]byte, 1024)
-	n, err := s.Read(buf)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to read")
-	}
 
-	data := buf[:n]
-	if s.Debug {
-		logbytes.LogPrefix(data, "S2C |")
-	}
+	for {
+		now := time.Now()
+		if err := s.retransmit(now); err != nil {
+			return nil, err
+		}
+		if err := s.syncDue(now); err != nil {
+			return nil, err
+		}
+		if err := s.flushDue(now); err != nil {
+			return nil, err
+		}
+
+		wake := deadline
+		if due, ok := s.nextRetransmit(); ok && due.Before(wake) {
+			wake = due
+		}
+		if due, ok := s.nextSync(); ok && due.Before(wake) {
+			wake = due
+		}
+		if due, ok := s.nextFlush(); ok && due.Before(wake) {
+			wake = due
+		}
 
-	return data, nil
+		err := s.SetReadDeadline(wake)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to set read deadline")
+		}
+
+		n, err := s.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && wake.Before(deadline) {
+				continue // a retransmission, a sync or a batch is due
+			}
+			return nil, errors.Wrap(err, "failed to read")
+		}
+
+		data := buf[:n]
+		if s.cipher != nil {
+			if err := s.cipher.Decrypt(data); err != nil {
+				log.Println("decrypt:", err)
+				continue
+			}
+		} else if !s.Raw {
+			s.handleKey(data)
+		}
+
+		s.capture(pcapng.Inbound, data)
+		if s.Debug != nil {
+			s.Debug.DumpPrefix(data, logbytes.ServerToClient)
+		}
+
+		s.sync.stats.Received++
+		if s.Raw {
+			return data, nil
+		}
+
+		for _, p := range Unpack(data) {
+			if len(p) >= 6 && p[0] == 0x00 && p[1] == 0x04 {
+				s.acked(endian.Uint32(p[2:6]), time.Now())
+			}
+			if _, err := s.handleSync(p, time.Now()); err != nil {
+				log.Println("sync:", err)
+			}
+		}
+
+		return data, nil
+	}
 }
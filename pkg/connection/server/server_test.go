@@ -0,0 +1,257 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ss-continuum/ssc/pkg/packetmap"
+)
+
+// newTestConn returns a Connection to a local UDP socket standing in for the server.
+func newTestConn(t *testing.T) (*Connection, net.PacketConn) {
+	t.Helper()
+
+	peer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("udp", peer.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		peer.Close()
+	})
+
+	return &Connection{Conn: conn}, peer
+}
+
+// received returns the datagrams the peer got, waiting a little for them.
+func received(t *testing.T, peer net.PacketConn) [][]byte {
+	t.Helper()
+
+	var got [][]byte
+	buf := make([]byte, 1024)
+	for {
+		_ = peer.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		n, _, err := peer.ReadFrom(buf)
+		if err != nil {
+			return got
+		}
+		got = append(got, append([]byte(nil), buf[:n]...))
+	}
+}
+
+func TestRTOBackoff(t *testing.T) {
+	s, peer := newTestConn(t)
+	s.MaxAttempts = 6
+
+	if err := s.SendReliable([]byte{0x01}); err != nil {
+		t.Fatal(err)
+	}
+	r := s.unacked[0]
+	now := r.sent
+
+	// initialRTO, then doubled on every attempt up to maxRTO
+	for _, wait := range []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second} {
+		if got := r.due.Sub(now); got != wait {
+			t.Fatalf("attempt %d due after %v, want %v", r.attempts, got, wait)
+		}
+
+		attempts := r.attempts
+		if err := s.retransmit(r.due.Add(-time.Millisecond)); err != nil || r.attempts != attempts {
+			t.Fatalf("retransmitted before due: %v", err)
+		}
+		now = r.due
+		if err := s.retransmit(now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := len(received(t, peer)); got != 6 {
+		t.Errorf("peer got %d copies, want 6", got)
+	}
+}
+
+func TestBackoffManyAttempts(t *testing.T) {
+	s, _ := newTestConn(t)
+	s.MaxAttempts = 100
+
+	_ = s.SendReliable([]byte{0x01})
+	r := s.unacked[0]
+	for r.attempts < 99 {
+		now := r.due
+		if err := s.retransmit(now); err != nil {
+			t.Fatal(err)
+		}
+		if wait := r.due.Sub(now); wait <= 0 || wait > maxRTO {
+			t.Fatalf("attempt %d due after %v", r.attempts, wait)
+		}
+	}
+}
+
+func TestReliableError(t *testing.T) {
+	s, peer := newTestConn(t)
+	s.MaxAttempts = 3
+
+	_ = s.SendReliable([]byte{0x01})
+	_ = s.SendReliable([]byte{0x02})
+	s.acked(1, time.Now())
+
+	r := s.unacked[0]
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = s.retransmit(r.due)
+	}
+
+	var reliableErr *ReliableError
+	if !errors.As(err, &reliableErr) {
+		t.Fatalf("retransmit error = %v, want a *ReliableError", err)
+	}
+	if reliableErr.ID != 0 || reliableErr.Attempts != 3 {
+		t.Errorf("got %+v, want id 0 after 3 attempts", reliableErr)
+	}
+	if s.Unacked() != 0 {
+		t.Errorf("%d packets still unacked", s.Unacked())
+	}
+	if got := len(received(t, peer)); got != 4 {
+		t.Errorf("peer got %d datagrams, want 4: 2 sent, 2 retransmitted", got)
+	}
+}
+
+func TestRTTEstimator(t *testing.T) {
+	var e rttEstimator
+	if e.rto() != initialRTO {
+		t.Errorf("rto before samples = %v, want %v", e.rto(), initialRTO)
+	}
+
+	e.add(100 * time.Millisecond)
+	if e.rto() != 300*time.Millisecond {
+		t.Errorf("rto after 100ms = %v, want 300ms", e.rto())
+	}
+
+	e = rttEstimator{}
+	e.add(time.Millisecond)
+	if e.rto() != minRTO {
+		t.Errorf("rto after 1ms = %v, want %v", e.rto(), minRTO)
+	}
+
+	e = rttEstimator{}
+	e.add(10 * time.Second)
+	if e.rto() != maxRTO {
+		t.Errorf("rto after 10s = %v, want %v", e.rto(), maxRTO)
+	}
+}
+
+func TestAckSample(t *testing.T) {
+	s, _ := newTestConn(t)
+
+	_ = s.SendReliable([]byte{0x01})
+	_ = s.SendReliable([]byte{0x02})
+	s.unacked[0].due = s.unacked[0].due.Add(time.Hour)
+	_ = s.retransmit(s.unacked[1].due)
+
+	s.acked(1, s.unacked[1].sent.Add(time.Second))
+	if s.RTT() != 0 {
+		t.Errorf("the ack of a retransmitted packet gave an RTT of %v", s.RTT())
+	}
+
+	s.acked(0, s.unacked[0].sent.Add(80*time.Millisecond))
+	if s.RTT() != 80*time.Millisecond {
+		t.Errorf("RTT = %v, want 80ms", s.RTT())
+	}
+}
+
+// windowPeer acks reliable packets like a receiver buffering window ids, and loses the first copy of id 0.
+// It returns the payloads in order, and the number of packets dropped for being past its window.
+func windowPeer(peer net.PacketConn, window uint32, count int) (payloads [][]byte, dropped int) {
+	next := uint32(0)
+	held := map[uint32][]byte{}
+	lost := false
+
+	buf := make([]byte, 1024)
+	for len(payloads) < count {
+		_ = peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, addr, err := peer.ReadFrom(buf)
+		if err != nil {
+			return payloads, dropped
+		}
+		if n < 6 || buf[0] != 0x00 || buf[1] != 0x03 {
+			continue
+		}
+
+		id := endian.Uint32(buf[2:6])
+		if id == 0 && !lost {
+			lost = true
+			continue
+		}
+		if id-next >= 1<<31 {
+			_, _ = peer.WriteTo([]byte{0x00, 0x04, buf[2], buf[3], buf[4], buf[5]}, addr)
+			continue
+		}
+		if id-next >= window {
+			dropped++
+			continue
+		}
+
+		_, _ = peer.WriteTo([]byte{0x00, 0x04, buf[2], buf[3], buf[4], buf[5]}, addr)
+		held[id] = append([]byte(nil), buf[6:n]...)
+		for p, ok := held[next]; ok; p, ok = held[next] {
+			payloads = append(payloads, p)
+			delete(held, next)
+			next++
+		}
+	}
+
+	return payloads, dropped
+}
+
+func TestSendWindow(t *testing.T) {
+	s, peer := newTestConn(t)
+	// small enough for the datagrams in flight to fit in the socket buffer, which would drop them silently
+	s.SendWindow = 16
+
+	data := make([]byte, 600*(packetmap.MaxBigChunk-6))
+	for i := range data {
+		data[i] = byte(i)
+	}
+	fragments, _ := packetmap.FragmentBig(data, 0)
+	if len(fragments) <= maxWindow {
+		t.Fatalf("%d fragments fit in the window", len(fragments))
+	}
+
+	type result struct {
+		payloads [][]byte
+		dropped  int
+	}
+	done := make(chan result)
+	go func() {
+		payloads, dropped := windowPeer(peer, uint32(s.SendWindow), len(fragments))
+		done <- result{payloads, dropped}
+	}()
+
+	if err := s.SendBigChunked(data); err != nil {
+		t.Fatal(err)
+	}
+	for s.Unacked() > 0 {
+		if err := s.readPacket(time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := <-done
+	if got.dropped != 0 {
+		t.Errorf("%d fragments sent past the receiver window", got.dropped)
+	}
+	var out bytes.Buffer
+	for _, p := range got.payloads {
+		out.Write(p[6:])
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("received %d bytes, want the %d sent", out.Len(), len(data))
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ss-continuum/ssc/pkg/bytestream"
+)
+
+// Tick is the unit of Subspace clocks: a hundredth of a second.
+const Tick = 10 * time.Millisecond
+
+// syncSamples is the number of recent syncs the clock offset is chosen from.
+const syncSamples = 8
+
+// epoch is the origin of the local clock sent in sync packets.
+var epoch = time.Now()
+
+// SyncStats is what the connection learned from 0x00 0x05 and 0x00 0x06 sync packets.
+type SyncStats struct {
+	// Synced is set once a sync response arrived. Offset and RTT are zero before.
+	Synced bool
+	// Offset is the server clock minus the local clock.
+	Offset time.Duration
+	// RTT is the round trip time of the sync the offset comes from.
+	RTT time.Duration
+
+	// ServerSent and ServerReceived are the packet counters of the last sync request the server sent.
+	ServerSent, ServerReceived uint32
+
+	// Sent and Received count the datagrams of the connection.
+	Sent, Received uint32
+}
+
+type syncSample struct {
+	offset time.Duration
+	rtt    time.Duration
+}
+
+// syncState is kept by the Connection.
+type syncState struct {
+	stats   SyncStats
+	samples []syncSample // the most recent syncs, oldest first
+	due     time.Time    // time of the next sync request
+}
+
+// Ticks returns the local clock, in ticks.
+func Ticks() uint32 {
+	return ticksAt(time.Now())
+}
+
+func ticksAt(t time.Time) uint32 {
+	return uint32(t.Sub(epoch) / Tick)
+}
+
+// ServerTime returns the estimated server clock, in ticks. It is the local clock until the first sync.
+func (s *Connection) ServerTime() uint32 {
+	return ticksAt(time.Now().Add(s.sync.stats.Offset))
+}
+
+// SyncStats returns the state of the clock synchronization and the packet counters.
+func (s *Connection) SyncStats() SyncStats {
+	return s.sync.stats
+}
+
+// SendSync sends a 0x00 0x05 sync request with the local clock and packet counters.
+func (s *Connection) SendSync() error {
+	out := bytestream.NewWriter(endian)
+	out.WriteBytes([]byte{0x00, 0x05})
+	out.WriteUint32(Ticks())
+	out.WriteUint32(s.sync.stats.Sent + 1) // this request counts
+	out.WriteUint32(s.sync.stats.Received)
+
+	if _, err := s.Write(out.Bytes()); err != nil {
+		return errors.Wrap(err, "s.Write")
+	}
+	s.sync.due = time.Now().Add(s.SyncInterval)
+
+	return nil
+}
+
+// syncDue sends a sync request when SyncInterval is set and the previous one is old enough.
+func (s *Connection) syncDue(now time.Time) error {
+	if s.SyncInterval <= 0 || now.Before(s.sync.due) {
+		return nil
+	}
+	return s.SendSync()
+}
+
+// nextSync returns the time the next sync request is due.
+func (s *Connection) nextSync() (time.Time, bool) {
+	return s.sync.due, s.SyncInterval > 0
+}
+
+// handleSync answers a sync request from the server, or measures the clock offset from a sync response.
+// It tells whether data was a sync packet.
+func (s *Connection) handleSync(data []byte, now time.Time) (bool, error) {
+	if len(data) < 2 || data[0] != 0x00 || (data[1] != 0x05 && data[1] != 0x06) {
+		return false, nil
+	}
+
+	in := bytestream.New(data[2:], endian)
+	local, err := in.ReadUint32()
+	if err != nil {
+		return true, errors.Wrap(err, "in.ReadUint32")
+	}
+
+	if data[1] == 0x05 {
+		// the counters are missing from some servers' requests
+		if sent, err := in.ReadUint32(); err == nil {
+			s.sync.stats.ServerSent = sent
+		}
+		if received, err := in.ReadUint32(); err == nil {
+			s.sync.stats.ServerReceived = received
+		}
+
+		out := bytestream.NewWriter(endian)
+		out.WriteBytes([]byte{0x00, 0x06})
+		out.WriteUint32(local)
+		out.WriteUint32(ticksAt(now))
+
+		if _, err := s.Write(out.Bytes()); err != nil {
+			return true, errors.Wrap(err, "s.Write")
+		}
+		return true, nil
+	}
+
+	remote, err := in.ReadUint32()
+	if err != nil {
+		return true, errors.Wrap(err, "in.ReadUint32")
+	}
+
+	rtt := time.Duration(ticksAt(now)-local) * Tick
+	if rtt > time.Minute {
+		return true, nil // not an answer to one of our requests
+	}
+
+	// the server read its clock about half way through the round trip
+	offset := time.Duration(int32(remote-ticksAt(now)))*Tick + rtt/2
+	s.addSyncSample(syncSample{offset: offset, rtt: rtt})
+
+	return true, nil
+}
+
+// addSyncSample keeps the offset of the recent sync with the shortest round trip, the one least skewed by
+// queuing delays.
+func (s *Connection) addSyncSample(sample syncSample) {
+	s.sync.samples = append(s.sync.samples, sample)
+	if len(s.sync.samples) > syncSamples {
+		s.sync.samples = s.sync.samples[1:]
+	}
+
+	best := s.sync.samples[0]
+	for _, sample := range s.sync.samples[1:] {
+		if sample.rtt < best.rtt {
+			best = sample
+		}
+	}
+
+	s.sync.stats.Synced = true
+	s.sync.stats.Offset, s.sync.stats.RTT = best.offset, best.rtt
+}
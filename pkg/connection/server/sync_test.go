@@ -0,0 +1,41 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSync(t *testing.T) {
+	s, peer := newTestConn(t)
+	now := time.Now()
+
+	// a response to a request sent 40ms ago by a server 10s ahead, which read its clock half way through
+	sent := ticksAt(now.Add(-40 * time.Millisecond))
+	remote := ticksAt(now.Add(10*time.Second - 20*time.Millisecond))
+	response := []byte{0x00, 0x06, byte(sent), byte(sent >> 8), byte(sent >> 16), byte(sent >> 24),
+		byte(remote), byte(remote >> 8), byte(remote >> 16), byte(remote >> 24)}
+
+	if ok, err := s.handleSync(response, now); !ok || err != nil {
+		t.Fatalf("handleSync = %v, %v", ok, err)
+	}
+	stats := s.SyncStats()
+	if !stats.Synced || stats.RTT != 40*time.Millisecond {
+		t.Errorf("stats %+v, want a 40ms round trip", stats)
+	}
+	if diff := stats.Offset - 10*time.Second; diff < -2*Tick || diff > 2*Tick {
+		t.Errorf("offset %v, want 10s", stats.Offset)
+	}
+
+	request := []byte{0x00, 0x05, 0x2a, 0, 0, 0, 7, 0, 0, 0, 6, 0, 0, 0}
+	if ok, err := s.handleSync(request, now); !ok || err != nil {
+		t.Fatalf("handleSync = %v, %v", ok, err)
+	}
+	if stats := s.SyncStats(); stats.ServerSent != 7 || stats.ServerReceived != 6 {
+		t.Errorf("server counters %d/%d, want 7/6", stats.ServerSent, stats.ServerReceived)
+	}
+	got := received(t, peer)
+	if len(got) != 1 || !bytes.Equal(got[0][:6], []byte{0x00, 0x06, 0x2a, 0, 0, 0}) {
+		t.Errorf("sync request answered with % x", got)
+	}
+}
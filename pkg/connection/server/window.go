@@ -0,0 +1,117 @@
+package server
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxWindow is how far past the next expected id a reliable packet is buffered. Packets further ahead are dropped
+// without an ack, so that the server sends them again later.
+const maxWindow = 256
+
+// Packet is a packet returned by ReadPacket.
+type Packet struct {
+	Data []byte
+
+	// Reliable is set when Data came in a 0x00 0x03 packet, whose reliable id is ID. When the reliable payload
+	// is a cluster, each of its packets is returned with the same ID.
+	Reliable bool
+	ID       uint32
+}
+
+// ReadPacket returns the next packet for higher layers, waiting at most duration. Reliable packets are acked,
+// duplicates are dropped and the payloads are returned strictly in id order, however the datagrams arrive.
+// Clusters are unpacked, reliable payloads included. Acks and sync packets are consumed; other packets are returned as they arrive.
+func (s *Connection) ReadPacket(duration time.Duration) (Packet, error) {
+	deadline := time.Now().Add(duration)
+
+	for len(s.queue) == 0 {
+		if err := s.readPacket(time.Until(deadline)); err != nil {
+			return Packet{}, err
+		}
+	}
+
+	p := s.queue[0]
+	s.queue = s.queue[1:]
+	return p, nil
+}
+
+// readPacket reads a datagram, waiting at most duration, and queues its packets for ReadPacket.
+func (s *Connection) readPacket(duration time.Duration) error {
+	data, err := s.ReadWithDeadline(duration)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range Unpack(data) {
+		if err := s.receive(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// receive queues a packet for ReadPacket.
+func (s *Connection) receive(data []byte) error {
+	if len(data) >= 2 && data[0] == 0x00 && (data[1] == 0x04 || data[1] == 0x05 || data[1] == 0x06) {
+		return nil
+	}
+	if len(data) < 6 || data[0] != 0x00 || data[1] != 0x03 {
+		s.queue = append(s.queue, Packet{Data: data})
+		return nil
+	}
+
+	id := endian.Uint32(data[2:6])
+	ahead := id - s.nextIncoming
+	if ahead >= 1<<31 {
+		// a copy of a packet already delivered, the server missed the ack
+		return errors.Wrap(s.Ack(id), "s.Ack")
+	}
+	if ahead >= maxWindow {
+		return nil
+	}
+
+	if err := s.Ack(id); err != nil {
+		return errors.Wrap(err, "s.Ack")
+	}
+
+	if s.incoming == nil {
+		s.incoming = make(map[uint32][]byte)
+	}
+	if _, ok := s.incoming[id]; !ok {
+		s.incoming[id] = data[6:]
+	}
+
+	for {
+		payload, ok := s.incoming[s.nextIncoming]
+		if !ok {
+			return nil
+		}
+
+		for _, p := range Unpack(payload) {
+			s.queue = append(s.queue, Packet{Data: p, Reliable: true, ID: s.nextIncoming})
+		}
+		delete(s.incoming, s.nextIncoming)
+		s.nextIncoming++
+	}
+}
+
+// MissingReliable returns the ids of the reliable packets holding back the ones already received, in order.
+func (s *Connection) MissingReliable() []uint32 {
+	last := s.nextIncoming
+	for id := range s.incoming {
+		if id-s.nextIncoming > last-s.nextIncoming {
+			last = id
+		}
+	}
+
+	var missing []uint32
+	for id := s.nextIncoming; len(s.incoming) > 0 && id != last; id++ {
+		if _, ok := s.incoming[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
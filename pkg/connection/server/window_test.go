@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+)
+
+func reliablePacket(id uint32, payload ...byte) []byte {
+	return append([]byte{0x00, 0x03, byte(id), byte(id >> 8), byte(id >> 16), byte(id >> 24)}, payload...)
+}
+
+func TestReceive(t *testing.T) {
+	s, peer := newTestConn(t)
+
+	for _, data := range [][]byte{
+		reliablePacket(2, 'c'),
+		reliablePacket(0, 'a'),
+		{0x00, 0x04, 0x09, 0x00, 0x00, 0x00}, // ack, consumed
+		{0x02, 'x'},                          // not core, returned as it arrives
+		reliablePacket(0, 'a'),               // copy of a delivered packet
+		reliablePacket(2, 'c'),               // copy of a held packet
+		reliablePacket(maxWindow+1, 'z'),     // past the window
+		reliablePacket(1, 'b'),
+	} {
+		if err := s.receive(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []Packet{
+		{Data: []byte("a"), Reliable: true, ID: 0},
+		{Data: []byte{0x02, 'x'}},
+		{Data: []byte("b"), Reliable: true, ID: 1},
+		{Data: []byte("c"), Reliable: true, ID: 2},
+	}
+	if len(s.queue) != len(want) {
+		t.Fatalf("queued %d packets, want %d: %v", len(s.queue), len(want), s.queue)
+	}
+	for i, p := range s.queue {
+		if !bytes.Equal(p.Data, want[i].Data) || p.Reliable != want[i].Reliable || p.ID != want[i].ID {
+			t.Errorf("packet %d = %+v, want %+v", i, p, want[i])
+		}
+	}
+
+	var acks []byte
+	for _, ack := range received(t, peer) {
+		acks = append(acks, ack[2])
+	}
+	if want := []byte{2, 0, 0, 2, 1}; !bytes.Equal(acks, want) {
+		t.Errorf("acked % x, want % x: every copy, nothing past the window", acks, want)
+	}
+}
+
+func TestMissingReliableWraparound(t *testing.T) {
+	s, _ := newTestConn(t)
+	s.nextIncoming = 0xfffffffe
+
+	_ = s.receive(reliablePacket(0xffffffff, 'b'))
+	_ = s.receive(reliablePacket(2, 'e'))
+
+	got := s.MissingReliable()
+	want := []uint32{0xfffffffe, 0, 1}
+	if len(got) != len(want) {
+		t.Fatalf("MissingReliable() = %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("MissingReliable() = %v, want %v", got, want)
+		}
+	}
+
+	_ = s.receive(reliablePacket(0xfffffffe, 'a'))
+	_ = s.receive(reliablePacket(0, 'c'))
+	_ = s.receive(reliablePacket(1, 'd'))
+	if len(s.queue) != 5 || s.nextIncoming != 3 || len(s.MissingReliable()) != 0 {
+		t.Errorf("queued %d packets, next id %d, missing %v", len(s.queue), s.nextIncoming, s.MissingReliable())
+	}
+}
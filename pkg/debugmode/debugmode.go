@@ -0,0 +1,42 @@
+// Package debugmode implements the -debug flag shared by the commands.
+package debugmode
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Mode is the value of a -debug flag. A bare -debug turns on hex dumps and -debug=dissect prints decoded packets.
+type Mode string
+
+const (
+	Off     Mode = ""
+	Hex     Mode = "hex"
+	Dissect Mode = "dissect"
+)
+
+func (m *Mode) String() string {
+	if m == nil || *m == Off {
+		return "false"
+	}
+	return string(*m)
+}
+
+func (m *Mode) Set(s string) error {
+	switch s {
+	case "false", "off":
+		*m = Off
+	case "true", "hex":
+		*m = Hex
+	case "dissect":
+		*m = Dissect
+	default:
+		return errors.Errorf("unknown debug mode %q, expected hex or dissect", s)
+	}
+
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (m *Mode) IsBoolFlag() bool {
+	return true
+}
@@ -11,7 +11,7 @@ type Directory struct {
 }
 
 func NewFromStream(stream *bytestream.ByteStream) (Directory, error) {
-	if h, err := stream.ReadByte(); err != nil {
+	if h, err := stream.ReadUint8(); err != nil {
 		return Directory{}, errors.Wrap(err, "failed to read header")
 	} else if h != 0x01 {
 		log.Printf("unexpected header: 0x%02x\n", h)
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/ss-continuum/ssc/pkg/bytestream"
-	"net"
 	"strings"
 )
 
+// MaxDescriptionLen is the size of the description field zones publish to the directory server.
+const MaxDescriptionLen = 386
+
 type Entry struct {
 	Name        string
 	Description string
@@ -20,11 +22,9 @@ type Entry struct {
 }
 
 func NewEntry(stream *bytestream.ByteStream) (Entry, error) {
-	ipAddress := make([]byte, 4)
-	if n, err := stream.Read(ipAddress); err != nil {
-		return Entry{}, errors.Wrap(err, "stream.Read")
-	} else if n != len(ipAddress) {
-		return Entry{}, errors.Errorf("failed to read ipAddress: expected %d, got %d", len(ipAddress), n)
+	ipAddress, err := stream.ReadIPv4()
+	if err != nil {
+		return Entry{}, errors.Wrap(err, "stream.ReadIPv4")
 	}
 	serverPort, err := stream.ReadUint16()
 	if err != nil {
@@ -43,22 +43,19 @@ func NewEntry(stream *bytestream.ByteStream) (Entry, error) {
 		return Entry{}, errors.Wrap(err, "stream.ReadUint32")
 	}
 
-	serverName := make([]byte, 64)
-	currentOffset := stream.Size() - int64(stream.Len())
-	if n, err := stream.Read(serverName); err != nil {
-		return Entry{}, errors.Wrap(err, "stream.Read")
-	} else if n != len(serverName) {
-		return Entry{}, errors.Errorf("failed to read serverName: expected %d, got %d (offset %v)", len(serverName), n, currentOffset)
+	serverName, err := stream.ReadFixedString(64)
+	if err != nil {
+		return Entry{}, errors.Wrap(err, "stream.ReadFixedString")
 	}
-	serverDescription, err := stream.ReadZeroString()
+	serverDescription, err := stream.ReadZeroStringMax(MaxDescriptionLen)
 	if err != nil {
-		return Entry{}, errors.Wrap(err, "stream.ReadZeroString")
+		return Entry{}, errors.Wrap(err, "stream.ReadZeroStringMax")
 	}
 
 	return Entry{
-		Name:         string(serverName),
+		Name:         serverName,
 		Description:  serverDescription,
-		IP:           net.IP(ipAddress).String(),
+		IP:           ipAddress.String(),
 		Port:         serverPort,
 		ScoreKeeping: scoreKeeping,
 		Players:      playerCount,
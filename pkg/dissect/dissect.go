@@ -0,0 +1,161 @@
+// Package dissect decodes Subspace datagrams into annotated trees, for debugging.
+package dissect
+
+import (
+	"encoding/binary"
+
+	"github.com/ss-continuum/ssc/pkg/bytestream"
+)
+
+var endian = binary.LittleEndian
+
+// Dissector decodes core protocol datagrams. It keeps track of chunked transfers to annotate every fragment with its
+// position, so a Dissector should only see the packets of one direction of one connection.
+type Dissector struct {
+	smallChunks int // fragments seen in the current 0x00 0x08 sequence
+	smallBytes  int // bytes seen in the current 0x00 0x08 sequence
+	bigBytes    int // bytes seen in the current 0x00 0x0a stream
+}
+
+// Dissect decodes a single datagram without chunk tracking.
+func Dissect(b []byte) *Node {
+	var d Dissector
+	return d.Dissect(b)
+}
+
+// Dissect decodes b, descending into reliable and cluster packets.
+func (d *Dissector) Dissect(b []byte) *Node {
+	if len(b) == 0 {
+		return &Node{Name: "empty packet"}
+	}
+
+	if b[0] != 0x00 {
+		return &Node{Name: "packet", Type: typeString(b[:1]), Payload: b[1:]}
+	}
+
+	if len(b) < 2 {
+		return &Node{Name: "truncated core packet", Type: typeString(b[:1])}
+	}
+
+	n := &Node{Name: "unknown core packet", Type: typeString(b[:2])}
+	in := bytestream.New(b[2:], endian)
+
+	var err error
+	switch b[1] {
+	case 0x01:
+		n.Name = "encryption request"
+		err = readFields(n, in, u32("key"), u16("protocol"))
+	case 0x02:
+		n.Name = "encryption response"
+		err = readFields(n, in, u32("key"))
+	case 0x03:
+		n.Name = "reliable"
+		if err = readFields(n, in, u32("id")); err == nil {
+			n.Children = append(n.Children, d.Dissect(rest(in)))
+		}
+	case 0x04:
+		n.Name = "ack"
+		err = readFields(n, in, u32("id"))
+	case 0x05:
+		n.Name = "sync request"
+		if err = readFields(n, in, u32("time")); err == nil && in.Len() > 0 {
+			err = readFields(n, in, u32("sent"), u32("received"))
+		}
+	case 0x06:
+		n.Name = "sync response"
+		err = readFields(n, in, u32("client time"), u32("server time"))
+	case 0x07:
+		n.Name = "disconnect"
+	case 0x08:
+		n.Name = "small chunk body"
+		d.smallChunks++
+		n.add("chunk", d.smallChunks)
+		n.add("offset", d.smallBytes)
+		d.smallBytes += in.Len()
+	case 0x09:
+		n.Name = "small chunk tail"
+		d.smallChunks++
+		n.add("chunk", d.smallChunks)
+		n.add("offset", d.smallBytes)
+		n.add("total", d.smallBytes+in.Len())
+		d.smallChunks, d.smallBytes = 0, 0
+	case 0x0a:
+		n.Name = "big chunk"
+		var total uint32
+		if total, err = in.ReadUint32(); err == nil {
+			n.add("total", total)
+			n.add("offset", d.bigBytes)
+			d.bigBytes += in.Len()
+			if d.bigBytes >= int(total) {
+				d.bigBytes = 0
+			}
+		}
+	case 0x0b:
+		n.Name = "cancel big chunk"
+	case 0x0c:
+		n.Name = "cancel big chunk ack"
+	case 0x0e:
+		n.Name = "cluster"
+		err = d.cluster(n, in)
+	}
+
+	if err != nil {
+		n.add("error", err.Error())
+	}
+	n.Payload = rest(in)
+
+	return n
+}
+
+func (d *Dissector) cluster(n *Node, in *bytestream.ByteStream) error {
+	for in.Len() > 0 {
+		size, err := in.ReadUint8()
+		if err != nil {
+			return err
+		}
+		sub, err := in.Sub(int(size))
+		if err != nil {
+			return err
+		}
+		n.Children = append(n.Children, d.Dissect(rest(sub)))
+	}
+
+	return nil
+}
+
+type field func(n *Node, in *bytestream.ByteStream) error
+
+func u32(name string) field {
+	return func(n *Node, in *bytestream.ByteStream) error {
+		v, err := in.ReadUint32()
+		if err == nil {
+			n.add(name, v)
+		}
+		return err
+	}
+}
+
+func u16(name string) field {
+	return func(n *Node, in *bytestream.ByteStream) error {
+		v, err := in.ReadUint16()
+		if err == nil {
+			n.add(name, v)
+		}
+		return err
+	}
+}
+
+func readFields(n *Node, in *bytestream.ByteStream, fields ...field) error {
+	for _, f := range fields {
+		if err := f(n, in); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rest consumes and returns whatever is left in the stream.
+func rest(in *bytestream.ByteStream) []byte {
+	b, _ := in.ReadBytes(in.Len())
+	return b
+}
@@ -0,0 +1,66 @@
+package dissect
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ss-continuum/ssc/pkg/logbytes"
+)
+
+// Node is one decoded packet. Packets carrying other packets, such as reliable or cluster packets, have them as
+// Children.
+type Node struct {
+	Name     string  `json:"name"`
+	Type     string  `json:"type,omitempty"` // type bytes, such as "0x00 0x03"
+	Fields   []Field `json:"fields,omitempty"`
+	Payload  []byte  `json:"payload,omitempty"` // bytes left undecoded
+	Children []*Node `json:"children,omitempty"`
+}
+
+// Field is a named value decoded from a packet.
+type Field struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+func (n *Node) add(name string, value interface{}) {
+	n.Fields = append(n.Fields, Field{Name: name, Value: value})
+}
+
+func typeString(b []byte) string {
+	pieces := make([]string, len(b))
+	for i, t := range b {
+		pieces[i] = fmt.Sprintf("0x%02x", t)
+	}
+	return strings.Join(pieces, " ")
+}
+
+// String renders the node and its children as an indented tree.
+func (n *Node) String() string {
+	var sb strings.Builder
+	n.write(&sb, 0)
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func (n *Node) write(sb *strings.Builder, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	sb.WriteString(indent)
+	sb.WriteString(n.Name)
+	if n.Type != "" {
+		fmt.Fprintf(sb, " (%s)", n.Type)
+	}
+	for _, f := range n.Fields {
+		fmt.Fprintf(sb, " %s=%v", f.Name, f.Value)
+	}
+	sb.WriteByte('\n')
+
+	for _, child := range n.Children {
+		child.write(sb, depth+1)
+	}
+
+	if len(n.Payload) > 0 {
+		fmt.Fprintf(sb, "%s  payload, %d bytes\n", indent, len(n.Payload))
+		logbytes.New(sb).DumpPrefix(n.Payload, indent+"  ")
+	}
+}
@@ -0,0 +1,95 @@
+package dissect
+
+import (
+	"github.com/ss-continuum/ssc/pkg/bytestream"
+)
+
+const (
+	pingGlobalSummary = 0x01
+	pingArenaSummary  = 0x02
+)
+
+// PingRequest decodes a ping protocol request, telling the versions apart by their size.
+func PingRequest(b []byte) *Node {
+	in := bytestream.New(b, endian)
+	n := &Node{Name: "ping v1 request"}
+
+	var err error
+	if len(b) == 8 {
+		n.Name = "ping v2 request"
+		err = readFields(n, in, u32("timestamp"), u32("options"))
+	} else {
+		err = readFields(n, in, u32("timestamp"))
+	}
+
+	if err != nil {
+		n.add("error", err.Error())
+	}
+	n.Payload = rest(in)
+
+	return n
+}
+
+// PingV1Response decodes the reply to a ping v1 request.
+func PingV1Response(b []byte) *Node {
+	in := bytestream.New(b, endian)
+	n := &Node{Name: "ping v1 response"}
+
+	if err := readFields(n, in, u32("total"), u32("timestamp")); err != nil {
+		n.add("error", err.Error())
+	}
+	n.Payload = rest(in)
+
+	return n
+}
+
+// PingV2Response decodes the reply to a ping v2 request, with one child per arena summary.
+func PingV2Response(b []byte) *Node {
+	in := bytestream.New(b, endian)
+	n := &Node{Name: "ping v2 response"}
+
+	if err := pingV2Response(n, in); err != nil {
+		n.add("error", err.Error())
+	}
+	n.Payload = rest(in)
+
+	return n
+}
+
+func pingV2Response(n *Node, in *bytestream.ByteStream) error {
+	if err := readFields(n, in, u32("timestamp")); err != nil {
+		return err
+	}
+	options, err := in.ReadUint32()
+	if err != nil {
+		return err
+	}
+	n.add("options", options)
+
+	if options&pingGlobalSummary != 0 {
+		if err := readFields(n, in, u32("total"), u32("playing")); err != nil {
+			return err
+		}
+	}
+
+	if options&pingArenaSummary != 0 {
+		for in.Len() > 0 {
+			name, err := in.ReadZeroString()
+			if err != nil {
+				return err
+			}
+			if name == "" {
+				break
+			}
+
+			arena := &Node{Name: "arena"}
+			arena.add("name", name)
+			n.Children = append(n.Children, arena)
+			if err := readFields(arena, in, u16("total"), u16("playing")); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package dissect
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/ss-continuum/ssc/pkg/logbytes"
+)
+
+// Printer logs the dissection of every datagram it is given. It implements logbytes.PacketLogger.
+type Printer struct {
+	logger *log.Logger
+	decode func(b []byte, prefix string) *Node
+
+	mu sync.Mutex
+}
+
+// NewPrinter returns a Printer for core protocol connections, keeping one Dissector per direction.
+func NewPrinter(l *log.Logger) *Printer {
+	dissectors := map[string]*Dissector{}
+
+	return &Printer{
+		logger: l,
+		decode: func(b []byte, prefix string) *Node {
+			d, ok := dissectors[prefix]
+			if !ok {
+				d = &Dissector{}
+				dissectors[prefix] = d
+			}
+			return d.Dissect(b)
+		},
+	}
+}
+
+// NewPingPrinter returns a Printer for the ping protocol of the given version (1 or 2).
+func NewPingPrinter(l *log.Logger, version int) *Printer {
+	return &Printer{
+		logger: l,
+		decode: func(b []byte, prefix string) *Node {
+			switch {
+			case prefix == logbytes.ClientToServer:
+				return PingRequest(b)
+			case version == 2:
+				return PingV2Response(b)
+			default:
+				return PingV1Response(b)
+			}
+		},
+	}
+}
+
+func (p *Printer) DumpPrefix(b []byte, prefix string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, line := range strings.Split(p.decode(b, prefix).String(), "\n") {
+		p.logger.Print(prefix + " " + line)
+	}
+}
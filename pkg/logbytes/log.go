@@ -1,18 +1,72 @@
 package logbytes
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
 
-func lines(b []byte) []string {
+// Prefixes marking the direction of a packet.
+const (
+	ClientToServer = "C2S |"
+	ServerToClient = "S2C |"
+)
+
+// PacketLogger is implemented by anything that can log a datagram, such as a Dumper.
+// The prefix is ClientToServer or ServerToClient.
+type PacketLogger interface {
+	DumpPrefix(b []byte, prefix string)
+}
+
+// Dumper writes hex dumps of packets, one line per Width bytes, to an io.Writer or a *log.Logger.
+type Dumper struct {
+	out    io.Writer
+	logger *log.Logger
+
+	// Width is the number of bytes per line. 16 when zero.
+	Width int
+	// Offset adds a column with the position of the first byte of each line.
+	Offset bool
+	// Timestamps starts every line with the time of the dump.
+	Timestamps bool
+}
+
+// New returns a Dumper writing to w.
+func New(w io.Writer) *Dumper {
+	return &Dumper{out: w}
+}
+
+// NewLogger returns a Dumper printing every line through l.
+func NewLogger(l *log.Logger) *Dumper {
+	return &Dumper{logger: l}
+}
+
+func (d *Dumper) width() int {
+	if d.Width <= 0 {
+		return 16
+	}
+	return d.Width
+}
+
+func (d *Dumper) lines(b []byte) []string {
 	var lines []string
-	var line string
+	var line strings.Builder
+	width := d.width()
+
+	for i := 0; i < len(b); i += width {
+		if d.Offset {
+			fmt.Fprintf(&line, "%04x  ", i)
+		}
 
-	for i := 0; i < len(b); i += 16 {
-		for k := 0; k < 16; k++ {
-			if k == 8 {
-				line += " "
+		for k := 0; k < width; k++ {
+			if k > 0 && k%8 == 0 {
+				line.WriteByte(' ')
 			}
 			if i+k >= len(b) {
-				line += " "
+				line.WriteByte(' ')
 				continue
 			}
 			c := b[i+k]
@@ -20,40 +74,70 @@ func lines(b []byte) []string {
 			if c < 32 || c > 126 {
 				c = '.'
 			}
-			line = fmt.Sprintf("%s%c", line, c)
+			line.WriteByte(c)
 		}
 
-		line += " |"
-		for k := 0; k < 16; k++ {
-			if k == 8 {
-				line += " "
+		line.WriteString(" |")
+		for k := 0; k < width; k++ {
+			if k > 0 && k%8 == 0 {
+				line.WriteByte(' ')
 			}
 			if i+k >= len(b) {
-				line += "   "
+				line.WriteString("   ")
 				continue
 			}
 
-			line = fmt.Sprintf("%s %02x", line, b[i+k])
+			fmt.Fprintf(&line, " %02x", b[i+k])
 		}
 
-		lines = append(lines, line)
-		line = ""
+		lines = append(lines, line.String())
+		line.Reset()
 	}
 	return lines
 }
 
-func Log(b []byte) {
-	data := lines(b)
+// Dump writes b.
+func (d *Dumper) Dump(b []byte) {
+	d.DumpPrefix(b, "")
+}
 
-	for _, datum := range data {
-		fmt.Println(datum)
+// DumpPrefix writes b, starting every line with prefix.
+func (d *Dumper) DumpPrefix(b []byte, prefix string) {
+	var head string
+	if d.Timestamps {
+		head = time.Now().Format("15:04:05.000000") + " "
+	}
+	if prefix != "" {
+		head += prefix + " "
 	}
-}
 
-func LogPrefix(b []byte, prefix string) {
-	data := lines(b)
+	data := d.lines(b)
+
+	if d.logger != nil {
+		for _, datum := range data {
+			d.logger.Print(head + datum)
+		}
+		return
+	}
 
+	// a single write keeps the dump in one piece when the writer is shared
+	var out strings.Builder
 	for _, datum := range data {
-		fmt.Printf("%s %s\n", prefix, datum)
+		out.WriteString(head)
+		out.WriteString(datum)
+		out.WriteByte('\n')
 	}
+	_, _ = io.WriteString(d.out, out.String())
+}
+
+var stdout = New(os.Stdout)
+
+// Log writes b to stdout.
+func Log(b []byte) {
+	stdout.Dump(b)
+}
+
+// LogPrefix writes b to stdout, starting every line with prefix.
+func LogPrefix(b []byte, prefix string) {
+	stdout.DumpPrefix(b, prefix)
 }
@@ -0,0 +1,128 @@
+package logbytes
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Packet is a datagram recovered from a dump.
+type Packet struct {
+	Prefix string // ClientToServer or ServerToClient
+	Data   []byte
+}
+
+// Parse reads the packets back from the output of DumpPrefix with the ClientToServer and ServerToClient prefixes,
+// as found in -debug logs. Timestamps and log prefixes in front of the direction are ignored, and so are lines
+// that are not part of a dump.
+//
+// A packet ends at a line that does not fill the dump width, at a change of direction or at any other line.
+// Without the offset column, two packets in a row in the same direction are merged when the first one fills its
+// last line exactly.
+func Parse(r io.Reader) ([]Packet, error) {
+	var packets []Packet
+	var cur *Packet // packet whose last line was full, so the next line may continue it
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		prefix, rest := splitPrefix(scanner.Text())
+		if prefix == "" {
+			cur = nil
+			continue
+		}
+
+		data, column, ok := parseLine(rest)
+		if !ok {
+			cur = nil
+			continue
+		}
+
+		start := 0
+		if cur != nil {
+			start = len(cur.Data)
+		}
+		offset, ascii := parseOffset(column, start)
+
+		if cur == nil || cur.Prefix != prefix || offset == 0 {
+			packets = append(packets, Packet{Prefix: prefix})
+			cur = &packets[len(packets)-1]
+		}
+
+		cur.Data = append(cur.Data, data...)
+
+		// the ascii column is padded to the full width, which tells whether this line is the last one
+		if len(data) < lineWidth(ascii) {
+			cur = nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "scanner.Scan")
+	}
+
+	return packets, nil
+}
+
+// splitPrefix finds the direction in line and returns it with the text that follows.
+func splitPrefix(line string) (string, string) {
+	for _, prefix := range []string{ClientToServer, ServerToClient} {
+		if i := strings.Index(line, prefix); i >= 0 {
+			return prefix, line[i+len(prefix):]
+		}
+	}
+
+	return "", ""
+}
+
+// parseLine decodes the hex column of a dump line and returns it with the columns in front of it.
+// ok is false for lines that are not dump lines.
+func parseLine(rest string) (data []byte, column string, ok bool) {
+	// the hex column never contains '|', so the last one is the separator
+	sep := strings.LastIndex(rest, " |")
+	if sep < 0 {
+		return nil, "", false
+	}
+
+	for _, field := range strings.Fields(rest[sep+2:]) {
+		b, err := hex.DecodeString(field)
+		if err != nil || len(b) != 1 {
+			return nil, "", false
+		}
+		data = append(data, b[0])
+	}
+
+	return data, strings.TrimPrefix(rest[:sep], " "), len(data) > 0
+}
+
+// parseOffset returns the value of the offset column and the ascii column that follows it.
+// The offset is -1 when the line has no offset column. Text from the ascii column can look like an offset, so only
+// 0 and the expected offset are accepted.
+func parseOffset(column string, expected int) (int, string) {
+	i := strings.Index(column, "  ")
+	if i < 4 {
+		return -1, column
+	}
+
+	n, err := strconv.ParseUint(column[:i], 16, 32)
+	if err != nil || (n != 0 && int(n) != expected) {
+		return -1, column
+	}
+
+	return int(n), column[i+2:]
+}
+
+// lineWidth returns the number of bytes per line of a dump from the length of its ascii column, which has an
+// extra space every 8 bytes.
+func lineWidth(ascii string) int {
+	for width := 1; width <= len(ascii); width++ {
+		if width+(width-1)/8 == len(ascii) {
+			return width
+		}
+	}
+
+	return 0
+}
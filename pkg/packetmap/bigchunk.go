@@ -0,0 +1,114 @@
+package packetmap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxBigChunk is the largest 0x00 0x0a transfer a BigChunk accepts when MaxSize is not set.
+const DefaultMaxBigChunk = 16 << 20
+
+// TooLargeError is returned when a 0x00 0x0a transfer announces more bytes than the BigChunk accepts.
+type TooLargeError struct {
+	Total, Max int
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("packetmap: big chunk of %d bytes exceeds the %d bytes limit", e.Total, e.Max)
+}
+
+// BigChunk reassembles a 0x00 0x0a transfer. Every fragment carries the total length of the transfer, which
+// must stay the same and must not be exceeded. Fragments must be added in reliable id order, as the Reassembler
+// does, and are written out right away, so a large transfer such as a map file can go straight to a file
+// through Out.
+type BigChunk struct {
+	// MaxSize is the largest total length accepted. DefaultMaxBigChunk when zero.
+	MaxSize int
+	// Progress, when set, is called each time data is written out.
+	Progress func(received, total int)
+	// Out receives the data. When nil, it is kept in memory and returned by Bytes.
+	Out io.Writer
+
+	buf      bytes.Buffer
+	total    int // -1 until the first fragment
+	received int // bytes written out
+}
+
+func NewBigChunk() *BigChunk {
+	return &BigChunk{total: -1}
+}
+
+func (b *BigChunk) maxSize() int {
+	if b.MaxSize <= 0 {
+		return DefaultMaxBigChunk
+	}
+	return b.MaxSize
+}
+
+// Started tells whether a fragment of the transfer has been added.
+func (b *BigChunk) Started() bool {
+	return b.total >= 0
+}
+
+// Total returns the length announced by the transfer, or -1 before the first fragment.
+func (b *BigChunk) Total() int {
+	return b.total
+}
+
+// Received returns the number of bytes written out so far.
+func (b *BigChunk) Received() int {
+	return b.received
+}
+
+// Add writes out the next 0x00 0x0a fragment of the transfer. complete is set once the announced length has
+// been written out.
+func (b *BigChunk) Add(chunk []byte) (complete bool, err error) {
+	if len(chunk) < 6 || chunk[0] != 0x00 || chunk[1] != 0x0a {
+		return false, errors.New("not a 0x0a chunk")
+	}
+
+	total := int(endian.Uint32(chunk[2:6]))
+	switch {
+	case b.total < 0 && total > b.maxSize():
+		return false, &TooLargeError{Total: total, Max: b.maxSize()}
+	case b.total < 0:
+		b.total = total
+	case total != b.total:
+		return false, errors.Errorf("big chunk announces %d bytes instead of %d", total, b.total)
+	}
+
+	body := chunk[6:]
+	if b.received+len(body) > b.total {
+		return false, errors.Errorf("big chunk overflows the %d bytes announced", b.total)
+	}
+
+	if b.Out != nil {
+		_, err = b.Out.Write(body)
+	} else {
+		_, err = b.buf.Write(body)
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "Write")
+	}
+	b.received += len(body)
+
+	if b.Progress != nil {
+		b.Progress(b.received, b.total)
+	}
+
+	return b.received == b.total, nil
+}
+
+// Bytes returns the data received so far when Out is nil.
+func (b *BigChunk) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// Reset drops the transfer, keeping MaxSize, Progress and Out.
+func (b *BigChunk) Reset() {
+	b.buf = bytes.Buffer{}
+	b.total, b.received = -1, 0
+}
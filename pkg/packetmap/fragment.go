@@ -0,0 +1,74 @@
+package packetmap
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxPacketSize is the largest datagram Subspace clients and servers accept.
+	MaxPacketSize = 520
+
+	// reliableHeader is the 0x00 0x03 type and id in front of every fragment.
+	reliableHeader = 6
+
+	// MaxChunk is the most data a 0x00 0x08 or 0x00 0x09 fragment carries.
+	MaxChunk = MaxPacketSize - reliableHeader - 2
+	// MaxBigChunk is the most data a 0x00 0x0a fragment carries.
+	MaxBigChunk = MaxPacketSize - reliableHeader - 6
+)
+
+// Fragment splits data into 0x00 0x08 fragments ended by a 0x00 0x09 tail, each meant to be sent as a reliable
+// packet. Every fragment carries at most size bytes of data, MaxChunk when size is zero or larger.
+func Fragment(data []byte, size int) [][]byte {
+	if size <= 0 || size > MaxChunk {
+		size = MaxChunk
+	}
+
+	var fragments [][]byte
+	for {
+		n, typ := len(data), byte(0x09)
+		if n > size {
+			n, typ = size, 0x08
+		}
+
+		fragments = append(fragments, append([]byte{0x00, typ}, data[:n]...))
+		data = data[n:]
+
+		if typ == 0x09 {
+			return fragments
+		}
+	}
+}
+
+// FragmentBig splits data into 0x00 0x0a fragments, each carrying the total length and at most size bytes of
+// data, MaxBigChunk when size is zero or larger.
+func FragmentBig(data []byte, size int) ([][]byte, error) {
+	if uint64(len(data)) > math.MaxUint32 {
+		return nil, errors.Errorf("%d bytes do not fit a big chunk", len(data))
+	}
+	if size <= 0 || size > MaxBigChunk {
+		size = MaxBigChunk
+	}
+
+	total := uint32(len(data))
+
+	var fragments [][]byte
+	for {
+		n := len(data)
+		if n > size {
+			n = size
+		}
+
+		fragment := make([]byte, 6, 6+n)
+		fragment[1] = 0x0a
+		endian.PutUint32(fragment[2:], total)
+		fragments = append(fragments, append(fragment, data[:n]...))
+		data = data[n:]
+
+		if len(data) == 0 {
+			return fragments, nil
+		}
+	}
+}
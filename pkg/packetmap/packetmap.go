@@ -2,45 +2,159 @@ package packetmap
 
 import (
 	"bytes"
+	"fmt"
 	"sort"
+
+	"github.com/pkg/errors"
 )
 
+// maxMissing caps the number of ids Missing reports.
+const maxMissing = 1024
+
 // PacketMap is useful when handling a stream of packets that needs to be ordered and bundled together.
-type PacketMap map[uint32][]byte
+// It knows the range of ids the stream spans, so that lost packets are noticed instead of silently skipped.
+type PacketMap struct {
+	packets map[uint32][]byte
 
-func New() PacketMap {
-	return make(map[uint32][]byte)
+	first, last       uint32
+	hasFirst, hasLast bool
 }
 
-func (p PacketMap) Add(id uint32, data []byte) {
-	p[id] = data
+func New() *PacketMap {
+	return &PacketMap{packets: make(map[uint32][]byte)}
 }
 
-func (p PacketMap) Clear() {
-	for k := range p {
-		delete(p, k)
+// Add stores the fragment carried by reliable packet id. Only 0x00 0x08, 0x00 0x09 and 0x00 0x0a fragments
+// are accepted, with their full header.
+func (p *PacketMap) Add(id uint32, data []byte) error {
+	if _, err := body(data); err != nil {
+		return errors.Wrapf(err, "packet %d", id)
 	}
+
+	p.packets[id] = data
+	return nil
 }
 
-func (p PacketMap) Size() int {
-	var size int
-	for _, packet := range p {
-		if packet[0] == 0x00 && packet[1] == 0x08 {
-			// remove packet header (2 bytes)
-			size += len(packet) - 2
-		} else if packet[0] == 0x00 && packet[1] == 0x0a {
-			// remove packet header (2 bytes) and size (4 bytes)
-			size += len(packet) - 6
+// Take removes the fragment of packet id from the map and returns it.
+func (p *PacketMap) Take(id uint32) ([]byte, bool) {
+	data, ok := p.packets[id]
+	if ok {
+		delete(p.packets, id)
+	}
+	return data, ok
+}
+
+// body returns the data of a fragment without its header.
+func body(data []byte) ([]byte, error) {
+	if len(data) < 2 {
+		return nil, errors.Errorf("packetmap: fragment of %d bytes has no header", len(data))
+	}
+	if data[0] != 0x00 {
+		return nil, errors.Errorf("packetmap: 0x%02x 0x%02x is not a fragment", data[0], data[1])
+	}
+
+	switch data[1] {
+	case 0x08, 0x09:
+		return data[2:], nil
+	case 0x0a:
+		if len(data) < 6 {
+			return nil, errors.Errorf("packetmap: 0x0a fragment of %d bytes has no length", len(data))
+		}
+		return data[6:], nil
+	}
+
+	return nil, errors.Errorf("packetmap: 0x%02x 0x%02x is not a fragment", data[0], data[1])
+}
+
+// SetFirst sets the id of the first packet of the stream. Without it, the lowest id added is assumed.
+func (p *PacketMap) SetFirst(id uint32) {
+	p.first, p.hasFirst = id, true
+}
+
+// SetLast sets the id of the last packet of the stream. Without it, the highest id added is assumed.
+func (p *PacketMap) SetLast(id uint32) {
+	p.last, p.hasLast = id, true
+}
+
+// Len returns the number of packets in the map.
+func (p *PacketMap) Len() int {
+	return len(p.packets)
+}
+
+func (p *PacketMap) Clear() {
+	for k := range p.packets {
+		delete(p.packets, k)
+	}
+	p.hasFirst, p.hasLast = false, false
+}
+
+// bounds returns the id range the stream spans.
+func (p *PacketMap) bounds() (first, last uint32, ok bool) {
+	first, last = p.first, p.last
+	for id := range p.packets {
+		if !p.hasFirst && (!ok || id < first) {
+			first = id
+		}
+		if !p.hasLast && (!ok || id > last) {
+			last = id
+		}
+		ok = true
+	}
+
+	return first, last, ok || (p.hasFirst && p.hasLast)
+}
+
+// Missing returns the ids between the first and the last packet that have not been added, in order.
+// At most 1024 ids are returned.
+func (p *PacketMap) Missing() []uint32 {
+	first, last, ok := p.bounds()
+	if !ok {
+		return nil
+	}
+
+	var missing []uint32
+	for id := first; id <= last && len(missing) < maxMissing; id++ {
+		if _, ok := p.packets[id]; !ok {
+			missing = append(missing, id)
+		}
+		if id == last {
+			break // last may be the largest uint32
 		}
+	}
+
+	return missing
+}
 
+// GapError is returned by Bytes while packets are missing from the stream.
+type GapError struct {
+	First, Last uint32
+	Missing     []uint32
+}
+
+func (e *GapError) Error() string {
+	return fmt.Sprintf("packetmap: %d packets missing between %d and %d, first missing %d", len(e.Missing), e.First, e.Last, e.Missing[0])
+}
+
+// Size returns the number of data bytes in the map, headers excluded.
+func (p *PacketMap) Size() int {
+	var size int
+	for _, packet := range p.packets {
+		data, _ := body(packet)
+		size += len(data)
 	}
 	return size
 }
 
-func (p PacketMap) Bytes() []byte {
-	keys := make([]uint32, len(p))
+// Bytes concatenates the packets in id order, once none is missing. Otherwise it returns a *GapError.
+func (p *PacketMap) Bytes() ([]byte, error) {
+	if missing := p.Missing(); len(missing) > 0 {
+		first, last, _ := p.bounds()
+		return nil, &GapError{First: first, Last: last, Missing: missing}
+	}
+
+	keys := make([]uint32, len(p.packets))
 	i := 0
-	for k := range p {
+	for k := range p.packets {
 		keys[i] = k
 		i++
 	}
@@ -48,19 +162,11 @@ func (p PacketMap) Bytes() []byte {
 
 	out := bytes.NewBuffer([]byte{})
 	for _, k := range keys {
-		data := p[k]
-		if data[0] == 0x00 && (data[1] == 0x08 || data[1] == 0x09) {
-			// remove packet header (2 bytes)
-			out.Write(data[2:])
-		} else if data[0] == 0x00 && data[1] == 0x0a {
-			// remove packet header (2 bytes) and size (4 bytes)
-			out.Write(data[6:])
-		} else {
-			out.Write(data)
-		}
+		data, _ := body(p.packets[k])
+		out.Write(data)
 	}
 
-	return out.Bytes()
+	return out.Bytes(), nil
 }
 
 func sortUint32(slice []uint32) {
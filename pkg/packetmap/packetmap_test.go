@@ -0,0 +1,324 @@
+package packetmap
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name  string
+		frags [][]byte
+		ok    []bool // whether Add accepts each fragment
+		size  int
+		data  []byte
+	}{
+		{
+			name:  "empty",
+			frags: [][]byte{nil, {}},
+			ok:    []bool{false, false},
+		},
+		{
+			name:  "no header",
+			frags: [][]byte{{0x00}, {0x08}},
+			ok:    []bool{false, false},
+		},
+		{
+			name:  "0x0a without length",
+			frags: [][]byte{{0x00, 0x0a}, {0x00, 0x0a, 0x01, 0x00, 0x00}},
+			ok:    []bool{false, false},
+		},
+		{
+			name:  "unknown types",
+			frags: [][]byte{{0x00, 0x03, 'a'}, {0x01, 0x08, 'a'}, {0x00, 0x0e, 0x01, 0x00}},
+			ok:    []bool{false, false, false},
+		},
+		{
+			name:  "header only",
+			frags: [][]byte{{0x00, 0x08}, {0x00, 0x09}, {0x00, 0x0a, 0x00, 0x00, 0x00, 0x00}},
+			ok:    []bool{true, true, true},
+		},
+		{
+			name:  "mixed 0x08 and 0x0a",
+			frags: [][]byte{{0x00, 0x08, 'a', 'b'}, {0x00, 0x0a, 0x02, 0x00, 0x00, 0x00, 'c', 'd'}, {0x00, 0x09, 'e'}},
+			ok:    []bool{true, true, true},
+			size:  5,
+			data:  []byte("abcde"),
+		},
+		{
+			name:  "malformed fragments among good ones",
+			frags: [][]byte{{0x00, 0x08, 'a'}, {0x00}, {0x00, 0x0a, 0x01}, {0x00, 0x09, 'b'}},
+			ok:    []bool{true, false, false, true},
+			size:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New()
+			for i, frag := range tt.frags {
+				if err := p.Add(uint32(i), frag); (err == nil) != tt.ok[i] {
+					t.Errorf("Add(% x): err = %v, want ok %v", frag, err, tt.ok[i])
+				}
+			}
+
+			if size := p.Size(); size != tt.size {
+				t.Errorf("Size() = %d, want %d", size, tt.size)
+			}
+			if tt.data == nil {
+				return
+			}
+			data, err := p.Bytes()
+			if err != nil || !bytes.Equal(data, tt.data) {
+				t.Errorf("Bytes() = %q, %v, want %q", data, err, tt.data)
+			}
+		})
+	}
+}
+
+func TestBytesGap(t *testing.T) {
+	p := New()
+	p.SetFirst(10)
+	_ = p.Add(11, []byte{0x00, 0x08, 'b'})
+	_ = p.Add(13, []byte{0x00, 0x09, 'd'})
+
+	_, err := p.Bytes()
+	var gap *GapError
+	if !errors.As(err, &gap) {
+		t.Fatalf("Bytes() error = %v, want a *GapError", err)
+	}
+	if want := []uint32{10, 12}; !equalIDs(gap.Missing, want) {
+		t.Errorf("missing %v, want %v", gap.Missing, want)
+	}
+}
+
+func equalIDs(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// bigFrag returns a 0x0a fragment of a transfer of total bytes.
+func bigFrag(total byte, body string) []byte {
+	return append([]byte{0x00, 0x0a, total, 0x00, 0x00, 0x00}, body...)
+}
+
+type add struct {
+	id   uint32
+	frag []byte // nil to skip id
+}
+
+func TestReassembler(t *testing.T) {
+	small := Fragment(bytes.Repeat([]byte{'s'}, 1200), 0)
+	big, _ := FragmentBig(bytes.Repeat([]byte{'b'}, 700), 0)
+
+	tests := []struct {
+		name   string
+		expect uint32
+		join   bool
+		adds   []add
+		want   []int  // length of each message delivered
+		last   string // content of the last one, when set
+		errs   int    // number of Add calls that fail
+	}{
+		{
+			name:   "big chunk split by another reliable packet",
+			expect: 10,
+			adds:   []add{{10, big[0]}, {11, nil}, {12, big[1]}},
+			want:   []int{700},
+		},
+		{
+			name:   "reordered small chunks",
+			expect: 10,
+			adds:   []add{{11, small[1]}, {10, small[0]}, {12, small[2]}},
+			want:   []int{1200},
+		},
+		{
+			name: "reordered small chunks from the start of the connection",
+			adds: []add{{1, small[1]}, {0, small[0]}, {2, small[2]}},
+			want: []int{1200},
+		},
+		{
+			name: "held until the missing start arrives",
+			adds: []add{{1, small[1]}, {2, small[2]}},
+		},
+		{
+			name:   "back to back messages",
+			expect: 5,
+			adds:   []add{{8, big[0]}, {5, small[0]}, {7, small[2]}, {9, big[1]}, {6, small[1]}, {5, small[0]}},
+			want:   []int{1200, 700},
+		},
+		{
+			name: "joined mid-message",
+			join: true,
+			adds: []add{{11, small[1]}, {10, small[0]}, {12, small[2]}, {14, small[1]}, {13, small[0]}, {15, small[2]}},
+			want: []int{1200},
+			errs: 1,
+		},
+		{
+			name: "joined before a big chunk",
+			join: true,
+			adds: []add{{20, big[1]}, {21, small[0]}, {23, small[2]}, {22, small[1]}},
+			want: []int{1200},
+			errs: 1,
+		},
+		{
+			name: "rest of a failed big chunk dropped",
+			adds: []add{{0, bigFrag(6, "ab")}, {1, bigFrag(7, "cd")}, {2, bigFrag(6, "ef")}, {3, bigFrag(4, "gh")}, {4, bigFrag(4, "ij")}},
+			want: []int{4},
+			errs: 1,
+		},
+		{
+			name: "failed big chunk followed by one of the same length",
+			adds: []add{{0, bigFrag(6, "ab")}, {1, bigFrag(5, "cd")}, {2, bigFrag(6, "ef")}, {3, bigFrag(6, "ghij")}, {4, bigFrag(6, "kl")}},
+			want: []int{6},
+			last: "ghijkl",
+			errs: 1,
+		},
+		{
+			name: "failed big chunk cut short by another length",
+			adds: []add{{0, bigFrag(6, "ab")}, {1, bigFrag(6, "cdefg")}, {2, bigFrag(4, "gh")}, {3, bigFrag(4, "ij")}},
+			want: []int{4},
+			errs: 1,
+		},
+		{
+			name: "failed big chunk cut short by a small chunk",
+			adds: []add{{0, bigFrag(6, "ab")}, {1, bigFrag(7, "cd")}, {2, small[0]}, {3, small[1]}, {4, small[2]}, {5, bigFrag(6, "uvwxyz")}},
+			want: []int{1200, 6},
+			errs: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			var last string
+			r := NewReassembler(func(data []byte) error {
+				got = append(got, len(data))
+				last = string(data)
+				return nil
+			})
+			if tt.expect != 0 {
+				r.Expect(tt.expect)
+			}
+			if tt.join {
+				r.Join()
+			}
+
+			errs := 0
+			for _, a := range tt.adds {
+				var err error
+				if a.frag == nil {
+					err = r.Skip(a.id)
+				} else {
+					err = r.Add(a.id, a.frag)
+				}
+				if err != nil {
+					errs++
+				}
+			}
+
+			if errs != tt.errs {
+				t.Errorf("%d errors, want %d", errs, tt.errs)
+			}
+			if !equalLens(got, tt.want) {
+				t.Errorf("messages of %v bytes, want %v", got, tt.want)
+			}
+			if tt.last != "" && last != tt.last {
+				t.Errorf("last message %q, want %q", last, tt.last)
+			}
+		})
+	}
+}
+
+func TestReassemblerHandlerError(t *testing.T) {
+	var got []string
+	r := NewReassembler(func(data []byte) error {
+		got = append(got, string(data))
+		if string(data) == "a" {
+			return errors.New("handler failed")
+		}
+		return nil
+	})
+
+	_ = r.Add(1, []byte{0x00, 0x09, 'b'})
+	_ = r.Add(2, bigFrag(0, "c")) // more than announced
+	_ = r.Add(3, []byte{0x00, 0x09, 'd'})
+	if err := r.Add(0, []byte{0x00, 0x09, 'a'}); err == nil {
+		t.Error("the handler error was not returned")
+	}
+
+	if want := []string{"a", "b", "d"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("delivered %q, want %q", got, want)
+	}
+	if missing := r.Missing(); len(missing) != 0 {
+		t.Errorf("Missing() = %v, want none", missing)
+	}
+}
+
+func TestReassemblerMissing(t *testing.T) {
+	r := NewReassembler(nil)
+	_ = r.Add(1, []byte{0x00, 0x08, 'b'})
+	_ = r.Skip(2)
+	_ = r.Add(4, []byte{0x00, 0x09, 'd'})
+
+	if got, want := r.Missing(), []uint32{0, 3}; !equalIDs(got, want) {
+		t.Errorf("Missing() = %v, want %v", got, want)
+	}
+}
+
+func equalLens(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBigChunk(t *testing.T) {
+	tests := []struct {
+		name  string
+		max   int
+		frags [][]byte
+		err   bool // whether the last Add fails
+		done  bool
+	}{
+		{name: "complete", frags: [][]byte{bigFrag(4, "ab"), bigFrag(4, "cd")}, done: true},
+		{name: "empty transfer", frags: [][]byte{bigFrag(0, "")}, done: true},
+		{name: "length changes", frags: [][]byte{bigFrag(4, "ab"), bigFrag(5, "cd")}, err: true},
+		{name: "overflow", frags: [][]byte{bigFrag(4, "ab"), bigFrag(4, "cde")}, err: true},
+		{name: "too large", max: 3, frags: [][]byte{bigFrag(4, "ab")}, err: true},
+		{name: "truncated", frags: [][]byte{{0x00, 0x0a, 0x04}}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBigChunk()
+			b.MaxSize = tt.max
+
+			var done bool
+			var err error
+			for _, f := range tt.frags {
+				if done, err = b.Add(f); err != nil {
+					break
+				}
+			}
+
+			if (err != nil) != tt.err || done != tt.done {
+				t.Errorf("done %v, err %v; want done %v, err %v", done, err, tt.done, tt.err)
+			}
+		})
+	}
+}
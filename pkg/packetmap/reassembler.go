@@ -0,0 +1,234 @@
+package packetmap
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+var endian = binary.LittleEndian
+
+// Reassembler rebuilds the chunked messages carried by reliable packets: 0x00 0x08 fragments ended by a
+// 0x00 0x09 tail, and 0x00 0x0a fragments prefixed by the total length. A connection can send any number of
+// them back to back. Fragments are processed in reliable id order, whatever order they arrive in, and each
+// completed message is passed to the handler in that order.
+type Reassembler struct {
+	handler func(data []byte) error
+
+	pending *PacketMap      // fragments waiting for the ones before them
+	skipped map[uint32]bool // reliable ids that carry something else
+	next    uint32          // id of the next fragment to process
+	hasNext bool            // unset after Join, until a message boundary shows where the next message starts
+
+	small bytes.Buffer // 0x08 message in progress
+	big   *BigChunk
+
+	brokenTotal int // length announced by a 0x0a transfer that failed
+	brokenLeft  int // bytes of it not seen yet, whose fragments are dropped
+}
+
+// NewReassembler returns a Reassembler calling handler with every completed message. It starts at reliable id 0,
+// the first of a connection; see Expect and Join for the other cases.
+func NewReassembler(handler func(data []byte) error) *Reassembler {
+	r := &Reassembler{
+		handler: handler,
+		pending: New(),
+		skipped: make(map[uint32]bool),
+		big:     NewBigChunk(),
+	}
+	r.Expect(0)
+	return r
+}
+
+// IsChunk tells whether a reliable payload is a fragment the Reassembler handles.
+func IsChunk(payload []byte) bool {
+	return len(payload) >= 2 && payload[0] == 0x00 && (payload[1] == 0x08 || payload[1] == 0x09 || payload[1] == 0x0a)
+}
+
+// Expect sets the reliable id of the next fragment, for a Reassembler that does not start at id 0.
+func (r *Reassembler) Expect(id uint32) {
+	r.next, r.hasNext = id, true
+	r.pending.SetFirst(id)
+}
+
+// Join is for a connection already under way, such as a capture started late, where the id of the next
+// fragment is not known. Fragments are held until a message boundary shows where a message starts: a 0x09
+// tail, or a 0x0a fragment followed by a 0x08 or 0x09 one. The fragments before that boundary are dropped with
+// an error, since the start of their message was not seen.
+func (r *Reassembler) Join() {
+	r.pending = New()
+	r.hasNext = false
+}
+
+// Skip tells the Reassembler that reliable packet id is not a fragment, so that processing goes on past it.
+// Reliable packets of other types interleaved with fragments must be skipped, or the messages after them stall.
+func (r *Reassembler) Skip(id uint32) error {
+	if !r.hasNext || id-r.next < 1<<31 {
+		r.skipped[id] = true
+	}
+	return r.process()
+}
+
+// BigChunk returns the reassembler used for 0x0a messages, to set its limit, progress callback or output.
+// When its Out is set, the handler receives nil for 0x0a messages.
+func (r *Reassembler) BigChunk() *BigChunk {
+	return r.big
+}
+
+// Missing returns the ids of the packets known to be missing: those between the next fragment to process and
+// the last one received.
+func (r *Reassembler) Missing() []uint32 {
+	var missing []uint32
+	for _, id := range r.pending.Missing() {
+		if !r.skipped[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// Add stores the fragment carried by reliable packet id, then processes every fragment that is next in line.
+// Copies of fragments already processed are ignored; fragments that arrive early wait for the ones before them.
+func (r *Reassembler) Add(id uint32, chunk []byte) error {
+	if !IsChunk(chunk) {
+		return errors.New("not a 0x08, 0x09 or 0x0a chunk")
+	}
+
+	if r.hasNext && id-r.next >= 1<<31 {
+		return nil
+	}
+
+	if err := r.pending.Add(id, chunk); err != nil {
+		return errors.Wrap(err, "pending.Add")
+	}
+
+	var err error
+	if !r.hasNext {
+		err = r.findStart()
+	}
+
+	if err := r.process(); err != nil {
+		return err
+	}
+	return err
+}
+
+// findStart looks for the first message boundary among the fragments held after Join. The fragments up to it
+// belong to a message whose start was not seen, and are dropped.
+func (r *Reassembler) findStart() error {
+	ids := make([]uint32, 0, len(r.pending.packets))
+	for id := range r.pending.packets {
+		ids = append(ids, id)
+	}
+	sortUint32(ids)
+
+	for _, id := range ids {
+		chunk := r.pending.packets[id]
+		next, ok := r.pending.packets[id+1]
+		if chunk[1] != 0x09 && !(chunk[1] == 0x0a && ok && next[1] != 0x0a) {
+			continue
+		}
+
+		dropped := 0
+		for _, old := range ids {
+			if old > id {
+				break
+			}
+			delete(r.pending.packets, old)
+			dropped++
+		}
+		for old := range r.skipped {
+			if old <= id {
+				delete(r.skipped, old)
+			}
+		}
+
+		r.Expect(id + 1)
+		return errors.Errorf("packetmap: %d fragments up to %d dropped, the start of their message was not seen", dropped, id)
+	}
+
+	return nil
+}
+
+// process handles the pending fragments that are next in line. A fragment that fails does not hold back the
+// ones after it; the first error is returned once they are all handled.
+func (r *Reassembler) process() error {
+	var first error
+	for r.hasNext {
+		if r.skipped[r.next] {
+			delete(r.skipped, r.next)
+			r.advance()
+			continue
+		}
+
+		chunk, ok := r.pending.Take(r.next)
+		if !ok {
+			break
+		}
+		r.advance()
+
+		if err := r.handle(chunk); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+func (r *Reassembler) advance() {
+	r.next++
+	r.pending.SetFirst(r.next)
+}
+
+// handle adds a fragment to the message it belongs to, and passes the message on when it is complete.
+// Once a 0x0a transfer fails, the rest of its fragments are dropped: those announcing its length, until that
+// length is used up. A fragment of another type or announcing another length starts a new message.
+func (r *Reassembler) handle(chunk []byte) error {
+	if r.brokenLeft > 0 && chunk[1] == 0x0a && int(endian.Uint32(chunk[2:6])) == r.brokenTotal {
+		r.brokenLeft -= len(chunk) - 6
+		return nil
+	}
+	r.brokenLeft = 0
+
+	switch chunk[1] {
+	case 0x08:
+		r.small.Write(chunk[2:])
+		return nil
+
+	case 0x09:
+		r.small.Write(chunk[2:])
+		data := append([]byte(nil), r.small.Bytes()...)
+		r.small.Reset()
+		return r.deliver(data)
+	}
+
+	complete, err := r.big.Add(chunk)
+	if err != nil {
+		r.brokenTotal = r.big.Total()
+		if !r.big.Started() {
+			r.brokenTotal = int(endian.Uint32(chunk[2:6]))
+		}
+		r.brokenLeft = r.brokenTotal - r.big.Received() - (len(chunk) - 6)
+		r.big.Reset()
+		return errors.Wrap(err, "big.Add")
+	}
+	if !complete {
+		return nil
+	}
+
+	var data []byte
+	if r.big.Out == nil {
+		data = r.big.Bytes()
+	}
+	r.big.Reset()
+
+	return r.deliver(data)
+}
+
+func (r *Reassembler) deliver(data []byte) error {
+	if r.handler == nil {
+		return nil
+	}
+	return errors.Wrap(r.handler(data), "handler")
+}
@@ -0,0 +1,290 @@
+package pcapng
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Link types understood by ParseUDP, besides LinkTypeRaw.
+const (
+	LinkTypeNull      = 0
+	LinkTypeEthernet  = 1
+	LinkTypeLinuxSLL  = 113
+	LinkTypeIPv4      = 228
+	LinkTypeIPv6      = 229
+	LinkTypeLinuxSLL2 = 276
+)
+
+const (
+	blockSimple   = 0x00000003
+	blockObsolete = 0x00000002
+
+	pcapMagicMicro = 0xa1b2c3d4
+	pcapMagicNano  = 0xa1b23c4d
+)
+
+// Packet is a captured frame.
+type Packet struct {
+	Time     time.Time
+	LinkType uint16
+	Data     []byte
+}
+
+// Reader reads packets from a pcapng file or a classic pcap file.
+type Reader struct {
+	r *bufio.Reader
+
+	next func() (Packet, error)
+
+	// pcapng state
+	order  binary.ByteOrder
+	ifaces []iface
+
+	// pcap state
+	linkType uint16
+	nanos    bool
+}
+
+type iface struct {
+	linkType uint16
+	tsPerSec uint64 // timestamp ticks per second
+}
+
+// NewReader detects the file format from its first bytes.
+func NewReader(r io.Reader) (*Reader, error) {
+	pr := &Reader{r: bufio.NewReader(r)}
+
+	magic, err := pr.r.Peek(4)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading magic")
+	}
+
+	if binary.LittleEndian.Uint32(magic) == blockSection {
+		pr.next = pr.nextBlock
+		return pr, nil
+	}
+
+	if err := pr.readPcapHeader(); err != nil {
+		return nil, err
+	}
+	pr.next = pr.nextRecord
+
+	return pr, nil
+}
+
+// Next returns the next packet, or io.EOF at the end of the file.
+func (r *Reader) Next() (Packet, error) {
+	return r.next()
+}
+
+func (r *Reader) readPcapHeader() error {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		return errors.Wrap(err, "reading pcap header")
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(header) {
+		case pcapMagicMicro:
+			r.order = order
+		case pcapMagicNano:
+			r.order, r.nanos = order, true
+		default:
+			continue
+		}
+
+		r.linkType = uint16(r.order.Uint32(header[20:24]))
+		return nil
+	}
+
+	return errors.Errorf("unknown file format, magic % x", header[:4])
+}
+
+func (r *Reader) nextRecord() (Packet, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		if err == io.EOF {
+			return Packet{}, io.EOF
+		}
+		return Packet{}, errors.Wrap(err, "reading record header")
+	}
+
+	sec := r.order.Uint32(header[0:4])
+	frac := r.order.Uint32(header[4:8])
+	capLen := r.order.Uint32(header[8:12])
+	if capLen > math.MaxUint16*4 {
+		return Packet{}, errors.Errorf("record too large: %d bytes", capLen)
+	}
+
+	data := make([]byte, capLen)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return Packet{}, errors.Wrap(err, "reading record")
+	}
+
+	nsec := int64(frac) * 1000
+	if r.nanos {
+		nsec = int64(frac)
+	}
+
+	return Packet{Time: time.Unix(int64(sec), nsec), LinkType: r.linkType, Data: data}, nil
+}
+
+func (r *Reader) nextBlock() (Packet, error) {
+	for {
+		blockType, body, err := r.readBlock()
+		if err != nil {
+			return Packet{}, err
+		}
+
+		switch blockType {
+		case blockSection:
+			r.ifaces = nil
+		case blockIface:
+			if err := r.addIface(body); err != nil {
+				return Packet{}, err
+			}
+		case blockEnhanced, blockObsolete:
+			return r.enhancedPacket(blockType, body)
+		case blockSimple:
+			return r.simplePacket(body)
+		}
+	}
+}
+
+// readBlock returns the type and the body of the next block, without the framing.
+func (r *Reader) readBlock() (uint32, []byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		if err == io.EOF {
+			return 0, nil, io.EOF
+		}
+		return 0, nil, errors.Wrap(err, "reading block header")
+	}
+
+	blockType := binary.LittleEndian.Uint32(header[0:4])
+	if blockType == blockSection {
+		// the byte order of a section is given by its header, right after the length
+		magic, err := r.r.Peek(4)
+		if err != nil {
+			return 0, nil, errors.Wrap(err, "reading byte order magic")
+		}
+		switch {
+		case binary.LittleEndian.Uint32(magic) == byteOrderMagic:
+			r.order = binary.LittleEndian
+		case binary.BigEndian.Uint32(magic) == byteOrderMagic:
+			r.order = binary.BigEndian
+		default:
+			return 0, nil, errors.Errorf("bad byte order magic % x", magic)
+		}
+	}
+	if r.order == nil {
+		return 0, nil, errors.New("block outside of a section")
+	}
+
+	blockType = r.order.Uint32(header[0:4])
+	total := r.order.Uint32(header[4:8])
+	if total < 12 || total%4 != 0 || total > 1<<24 {
+		return 0, nil, errors.Errorf("bad block length %d", total)
+	}
+
+	body := make([]byte, total-8)
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return 0, nil, errors.Wrap(err, "reading block")
+	}
+
+	return blockType, body[:len(body)-4], nil
+}
+
+func (r *Reader) addIface(body []byte) error {
+	if len(body) < 8 {
+		return errors.New("interface block too short")
+	}
+
+	ifc := iface{linkType: r.order.Uint16(body[0:2]), tsPerSec: 1e6}
+
+	opts := body[8:]
+	for len(opts) >= 4 {
+		code, size := r.order.Uint16(opts[0:2]), int(r.order.Uint16(opts[2:4]))
+		if code == optEnd || 4+size > len(opts) {
+			break
+		}
+		if code == optTSResol && size == 1 {
+			tsPerSec, err := tsResolution(opts[4])
+			if err != nil {
+				return err
+			}
+			ifc.tsPerSec = tsPerSec
+		}
+		opts = opts[4+size+pad(size):]
+	}
+
+	r.ifaces = append(r.ifaces, ifc)
+
+	return nil
+}
+
+// tsResolution returns the timestamp ticks per second of an if_tsresol value: a negative power of 2 when the
+// high bit is set, of 10 otherwise. Resolutions finer than a uint64 can count are rejected.
+func tsResolution(res byte) (uint64, error) {
+	if res&0x80 != 0 {
+		if res&0x7f >= 64 {
+			return 0, errors.Errorf("timestamp resolution 2^-%d not supported", res&0x7f)
+		}
+		return 1 << (res & 0x7f), nil
+	}
+
+	if res > 19 {
+		return 0, errors.Errorf("timestamp resolution 10^-%d not supported", res)
+	}
+	tsPerSec := uint64(1)
+	for i := byte(0); i < res; i++ {
+		tsPerSec *= 10
+	}
+	return tsPerSec, nil
+}
+
+func (r *Reader) enhancedPacket(blockType uint32, body []byte) (Packet, error) {
+	if len(body) < 20 {
+		return Packet{}, errors.New("packet block too short")
+	}
+
+	id := int(r.order.Uint32(body[0:4]))
+	if blockType == blockObsolete {
+		id = int(r.order.Uint16(body[0:2]))
+	}
+	if id >= len(r.ifaces) {
+		return Packet{}, errors.Errorf("packet for unknown interface %d", id)
+	}
+	ifc := r.ifaces[id]
+
+	ts := uint64(r.order.Uint32(body[4:8]))<<32 | uint64(r.order.Uint32(body[8:12]))
+	capLen := int(r.order.Uint32(body[12:16]))
+	if 20+capLen > len(body) {
+		return Packet{}, errors.Errorf("captured length %d past the end of the block", capLen)
+	}
+
+	// the fraction times 1e9 may not fit 64 bits for fine resolutions, the quotient always does
+	sec := ts / ifc.tsPerSec
+	hi, lo := bits.Mul64(ts%ifc.tsPerSec, 1e9)
+	nsec, _ := bits.Div64(hi, lo, ifc.tsPerSec)
+
+	return Packet{
+		Time:     time.Unix(int64(sec), int64(nsec)),
+		LinkType: ifc.linkType,
+		Data:     body[20 : 20+capLen],
+	}, nil
+}
+
+func (r *Reader) simplePacket(body []byte) (Packet, error) {
+	if len(body) < 4 || len(r.ifaces) == 0 {
+		return Packet{}, errors.New("bad simple packet block")
+	}
+
+	return Packet{LinkType: r.ifaces[0].linkType, Data: body[4:]}, nil
+}
@@ -0,0 +1,76 @@
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// captureWithResolution returns a pcapng file whose interface has the given if_tsresol and one packet stamped ts.
+func captureWithResolution(res byte, ts uint64) []byte {
+	var out bytes.Buffer
+	block := func(blockType uint32, body []byte) {
+		size := uint32(12 + len(body))
+		_ = binary.Write(&out, binary.LittleEndian, blockType)
+		_ = binary.Write(&out, binary.LittleEndian, size)
+		out.Write(body)
+		_ = binary.Write(&out, binary.LittleEndian, size)
+	}
+
+	shb := []byte{0x4d, 0x3c, 0x2b, 0x1a, 1, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	block(blockSection, shb)
+
+	idb := []byte{LinkTypeRaw, 0, 0, 0, 0, 0, 0, 0, optTSResol, 0, 1, 0, res, 0, 0, 0, optEnd, 0, 0, 0}
+	block(blockIface, idb)
+
+	epb := make([]byte, 20, 24)
+	binary.LittleEndian.PutUint32(epb[4:], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(epb[8:], uint32(ts))
+	binary.LittleEndian.PutUint32(epb[12:], 4)
+	binary.LittleEndian.PutUint32(epb[16:], 4)
+	block(blockEnhanced, append(epb, 0x45, 0, 0, 0))
+
+	return out.Bytes()
+}
+
+func TestResolution(t *testing.T) {
+	tests := []struct {
+		res  byte
+		ts   uint64
+		want time.Time
+	}{
+		{res: 6, ts: 1_700_000_000_123_456, want: time.Unix(1_700_000_000, 123_456_000)},
+		{res: 9, ts: 1_700_000_000_123_456_789, want: time.Unix(1_700_000_000, 123_456_789)},
+		{res: 12, ts: 1_700_000_000_123_456_789, want: time.Unix(1_700_000, 123_456)},
+		{res: 19, ts: 9_999_999_999_999_999_999, want: time.Unix(0, 999_999_999)},
+		{res: 0x80 | 10, ts: 1024*5 + 512, want: time.Unix(5, 500_000_000)},
+		{res: 0x80 | 63, ts: 1 << 62, want: time.Unix(0, 500_000_000)},
+	}
+
+	for _, tt := range tests {
+		r, err := NewReader(bytes.NewReader(captureWithResolution(tt.res, tt.ts)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := r.Next()
+		if err != nil {
+			t.Fatalf("resolution %#x: %v", tt.res, err)
+		}
+		if !p.Time.Equal(tt.want) {
+			t.Errorf("resolution %#x: time %v, want %v", tt.res, p.Time, tt.want)
+		}
+	}
+}
+
+func TestBadResolution(t *testing.T) {
+	for _, res := range []byte{0x80 | 64, 0xc0, 0xff, 20, 100, 0x7f} {
+		r, err := NewReader(bytes.NewReader(captureWithResolution(res, 1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Next(); err == nil {
+			t.Errorf("resolution %#x accepted", res)
+		}
+	}
+}
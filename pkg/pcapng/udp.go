@@ -0,0 +1,195 @@
+package pcapng
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ss-continuum/ssc/pkg/bytestream"
+)
+
+const protoUDP = 17
+
+// udpPacket builds an IPv4 or IPv6 packet holding a UDP datagram with the given payload.
+func udpPacket(src, dst netip.AddrPort, id uint16, payload []byte) ([]byte, error) {
+	srcIP, dstIP := src.Addr().Unmap(), dst.Addr().Unmap()
+	if srcIP.Is4() != dstIP.Is4() {
+		return nil, errors.Errorf("address family mismatch: %s -> %s", src, dst)
+	}
+
+	udpLen := 8 + len(payload)
+	udp := bytestream.NewWriter(binary.BigEndian)
+	udp.WriteUint16(src.Port())
+	udp.WriteUint16(dst.Port())
+	udp.WriteUint16(uint16(udpLen))
+	udp.WriteUint16(0) // checksum, filled in below
+	udp.WriteBytes(payload)
+
+	// pseudo header for the UDP checksum
+	pseudo := bytestream.NewWriter(binary.BigEndian)
+	pseudo.WriteBytes(srcIP.AsSlice())
+	pseudo.WriteBytes(dstIP.AsSlice())
+	pseudo.WriteUint16(protoUDP)
+	pseudo.WriteUint16(uint16(udpLen))
+
+	datagram := udp.Bytes()
+	sum := checksum(pseudo.Bytes(), datagram)
+	if sum == 0 {
+		sum = 0xffff
+	}
+	binary.BigEndian.PutUint16(datagram[6:8], sum)
+
+	ip := bytestream.NewWriter(binary.BigEndian)
+	if srcIP.Is4() {
+		ip.WriteUint8(0x45) // version 4, 20 byte header
+		ip.WriteUint8(0)    // type of service
+		ip.WriteUint16(uint16(20 + udpLen))
+		ip.WriteUint16(id)
+		ip.WriteUint16(0x4000) // don't fragment
+		ip.WriteUint8(64)      // ttl
+		ip.WriteUint8(protoUDP)
+		ip.WriteUint16(0) // checksum, filled in below
+		ip.WriteBytes(srcIP.AsSlice())
+		ip.WriteBytes(dstIP.AsSlice())
+
+		header := ip.Bytes()
+		binary.BigEndian.PutUint16(header[10:12], checksum(header))
+	} else {
+		ip.WriteUint32(6 << 28) // version 6, no traffic class or flow label
+		ip.WriteUint16(uint16(udpLen))
+		ip.WriteUint8(protoUDP)
+		ip.WriteUint8(64) // hop limit
+		ip.WriteBytes(srcIP.AsSlice())
+		ip.WriteBytes(dstIP.AsSlice())
+	}
+
+	ip.WriteBytes(datagram)
+
+	return ip.Bytes(), nil
+}
+
+// checksum is the internet checksum over the concatenation of parts.
+func checksum(parts ...[]byte) uint16 {
+	var sum uint32
+	var odd bool
+	var last byte
+
+	for _, part := range parts {
+		for _, c := range part {
+			if odd {
+				sum += uint32(last)<<8 | uint32(c)
+			} else {
+				last = c
+			}
+			odd = !odd
+		}
+	}
+	if odd {
+		sum += uint32(last) << 8
+	}
+
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+
+	return ^uint16(sum)
+}
+
+// Datagram is a UDP datagram found in a captured packet.
+type Datagram struct {
+	Time     time.Time
+	Src, Dst netip.AddrPort
+	Payload  []byte
+}
+
+// ParseUDP extracts the UDP datagram carried by p. It returns false for anything else, IP fragments included.
+func ParseUDP(p Packet) (Datagram, bool) {
+	ip, ok := ipPayload(p.LinkType, p.Data)
+	if !ok || len(ip) < 1 {
+		return Datagram{}, false
+	}
+
+	var src, dst netip.Addr
+	var udp []byte
+
+	switch ip[0] >> 4 {
+	case 4:
+		ihl := int(ip[0]&0x0f) * 4
+		if len(ip) < 20 || ihl < 20 || len(ip) < ihl || ip[9] != protoUDP {
+			return Datagram{}, false
+		}
+		if binary.BigEndian.Uint16(ip[6:8])&0x3fff != 0 {
+			return Datagram{}, false // fragment
+		}
+		total := int(binary.BigEndian.Uint16(ip[2:4]))
+		if total >= ihl && total <= len(ip) {
+			ip = ip[:total]
+		}
+		src = netip.AddrFrom4([4]byte{ip[12], ip[13], ip[14], ip[15]})
+		dst = netip.AddrFrom4([4]byte{ip[16], ip[17], ip[18], ip[19]})
+		udp = ip[ihl:]
+	case 6:
+		if len(ip) < 40 || ip[6] != protoUDP {
+			return Datagram{}, false
+		}
+		var s, d [16]byte
+		copy(s[:], ip[8:24])
+		copy(d[:], ip[24:40])
+		src, dst = netip.AddrFrom16(s), netip.AddrFrom16(d)
+		udp = ip[40:]
+	default:
+		return Datagram{}, false
+	}
+
+	if len(udp) < 8 {
+		return Datagram{}, false
+	}
+	length := int(binary.BigEndian.Uint16(udp[4:6]))
+	if length < 8 || length > len(udp) {
+		length = len(udp)
+	}
+
+	return Datagram{
+		Time:    p.Time,
+		Src:     netip.AddrPortFrom(src, binary.BigEndian.Uint16(udp[0:2])),
+		Dst:     netip.AddrPortFrom(dst, binary.BigEndian.Uint16(udp[2:4])),
+		Payload: udp[8:length],
+	}, true
+}
+
+// ipPayload strips the link layer header.
+func ipPayload(linkType uint16, data []byte) ([]byte, bool) {
+	switch linkType {
+	case LinkTypeRaw, LinkTypeIPv4, LinkTypeIPv6:
+		return data, true
+	case LinkTypeNull:
+		if len(data) < 4 {
+			return nil, false
+		}
+		return data[4:], true
+	case LinkTypeEthernet:
+		if len(data) < 14 {
+			return nil, false
+		}
+		etherType, rest := binary.BigEndian.Uint16(data[12:14]), data[14:]
+		for etherType == 0x8100 && len(rest) >= 4 { // vlan tags
+			etherType, rest = binary.BigEndian.Uint16(rest[2:4]), rest[4:]
+		}
+		return rest, etherType == 0x0800 || etherType == 0x86dd
+	case LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(data[14:16])
+		return data[16:], etherType == 0x0800 || etherType == 0x86dd
+	case LinkTypeLinuxSLL2:
+		if len(data) < 20 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(data[0:2])
+		return data[20:], etherType == 0x0800 || etherType == 0x86dd
+	}
+
+	return nil, false
+}
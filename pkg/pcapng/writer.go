@@ -0,0 +1,160 @@
+// Package pcapng writes captured datagrams as pcapng files that Wireshark can open, and reads pcapng and classic
+// pcap files back.
+// UDP and IP headers are synthesized from the connection addresses, since only the payloads are seen.
+package pcapng
+
+import (
+	"encoding/binary"
+	"io"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ss-continuum/ssc/pkg/bytestream"
+)
+
+var endian = binary.LittleEndian
+
+const (
+	blockSection  = 0x0a0d0d0a
+	blockIface    = 0x00000001
+	blockEnhanced = 0x00000006
+
+	byteOrderMagic = 0x1a2b3c4d
+
+	// LinkTypeRaw means packets start with an IPv4 or IPv6 header.
+	LinkTypeRaw = 101
+
+	optEnd      = 0
+	optTSResol  = 9 // interface block: timestamp resolution
+	optEPBFlags = 2 // enhanced packet block: direction
+
+	snapLen = 65535
+)
+
+// Direction of a packet, stored in its flags.
+type Direction uint32
+
+const (
+	Inbound  Direction = 1
+	Outbound Direction = 2
+)
+
+// Writer appends packets to a pcapng stream. It is safe for concurrent use.
+type Writer struct {
+	w  io.Writer
+	mu sync.Mutex
+
+	ipID uint16
+}
+
+// NewWriter writes the section and interface headers to w and returns a Writer for the packets.
+func NewWriter(w io.Writer) (*Writer, error) {
+	pw := &Writer{w: w}
+
+	shb := bytestream.NewWriter(endian)
+	shb.WriteUint32(byteOrderMagic)
+	shb.WriteUint16(1) // major version
+	shb.WriteUint16(0) // minor version
+	shb.WriteInt64(-1) // section length: unknown
+	if err := pw.writeBlock(blockSection, shb.Bytes()); err != nil {
+		return nil, errors.Wrap(err, "section header")
+	}
+
+	idb := bytestream.NewWriter(endian)
+	idb.WriteUint16(LinkTypeRaw)
+	idb.WriteUint16(0) // reserved
+	idb.WriteUint32(snapLen)
+	writeOption(idb, optTSResol, []byte{9}) // nanoseconds
+	writeOption(idb, optEnd, nil)
+	if err := pw.writeBlock(blockIface, idb.Bytes()); err != nil {
+		return nil, errors.Wrap(err, "interface description")
+	}
+
+	return pw, nil
+}
+
+// Create creates the file at path and returns a Writer for it. Close the Writer to close the file.
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "os.Create")
+	}
+
+	w, err := NewWriter(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Close closes the underlying writer, if it can be closed.
+func (w *Writer) Close() error {
+	if c, ok := w.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// WritePacket records a UDP datagram carrying payload from src to dst, seen at ts.
+func (w *Writer) WritePacket(ts time.Time, src, dst netip.AddrPort, dir Direction, payload []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.ipID++
+	packet, err := udpPacket(src, dst, w.ipID, payload)
+	if err != nil {
+		return err
+	}
+
+	nanos := uint64(ts.UnixNano())
+
+	epb := bytestream.NewWriter(endian)
+	epb.WriteUint32(0) // interface id
+	epb.WriteUint32(uint32(nanos >> 32))
+	epb.WriteUint32(uint32(nanos))
+	epb.WriteUint32(uint32(len(packet))) // captured length
+	epb.WriteUint32(uint32(len(packet))) // original length
+	epb.WriteBytes(packet)
+	epb.WriteBytes(make([]byte, pad(len(packet))))
+
+	flags := make([]byte, 4)
+	endian.PutUint32(flags, uint32(dir))
+	writeOption(epb, optEPBFlags, flags)
+	writeOption(epb, optEnd, nil)
+
+	return w.writeBlock(blockEnhanced, epb.Bytes())
+}
+
+// writeBlock frames body with the block type and the total length, which is repeated at the end.
+func (w *Writer) writeBlock(blockType uint32, body []byte) error {
+	total := uint32(12 + len(body))
+
+	out := bytestream.NewWriter(endian)
+	out.WriteUint32(blockType)
+	out.WriteUint32(total)
+	out.WriteBytes(body)
+	out.WriteUint32(total)
+
+	if _, err := w.w.Write(out.Bytes()); err != nil {
+		return errors.Wrap(err, "w.Write")
+	}
+
+	return nil
+}
+
+func writeOption(out *bytestream.Writer, code uint16, value []byte) {
+	out.WriteUint16(code)
+	out.WriteUint16(uint16(len(value)))
+	out.WriteBytes(value)
+	out.WriteBytes(make([]byte, pad(len(value))))
+}
+
+// pad returns the number of bytes needed to align n to 32 bits.
+func pad(n int) int {
+	return (4 - n%4) % 4
+}
@@ -0,0 +1,138 @@
+// Package vie implements the encryption of the original Subspace (VIE) protocol.
+//
+// The client sends a key in its 0x00 0x01 encryption request and the server answers with its own key in the
+// 0x00 0x02 response. When the server key is zero or the client key sent back, the session is not encrypted.
+// Otherwise both sides build a table from the server key and XOR every later datagram with it, chaining 32 bit
+// words.
+package vie
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+var endian = binary.LittleEndian
+
+// MaxPacketSize is the largest datagram the table covers.
+const MaxPacketSize = 520
+
+// Cipher encrypts and decrypts the datagrams of a session.
+type Cipher struct {
+	key   uint32
+	table [MaxPacketSize / 4]uint32
+}
+
+// NewCipher returns the Cipher for a server key. The key must not be zero.
+func NewCipher(key uint32) *Cipher {
+	c := &Cipher{key: key}
+
+	var shorts [MaxPacketSize / 2]uint16
+	k := int32(key)
+	for i := range shorts {
+		// t is k / 127773, truncated: the multiply and shift round down, so negative k need one added back
+		t := int32((int64(k) * 0x834E0B5F) >> 48)
+		t += int32(uint32(t) >> 31)
+		k = (k%127773)*16807 - t*2836 + 123
+		if k <= 0 {
+			k += 0x7FFFFFFF
+		}
+		shorts[i] = uint16(k)
+	}
+
+	for i := range c.table {
+		c.table[i] = uint32(shorts[2*i]) | uint32(shorts[2*i+1])<<16
+	}
+
+	return c
+}
+
+// GenerateKey returns a random client key. Like the Subspace client's, it is negative as an int32.
+func GenerateKey() (uint32, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, errors.Wrap(err, "rand.Read")
+	}
+
+	return endian.Uint32(b[:]) | 0x80000000, nil
+}
+
+// Enabled tells whether a session whose client sent clientKey and whose server answered serverKey is encrypted.
+func Enabled(clientKey, serverKey uint32) bool {
+	return serverKey != 0 && serverKey != clientKey
+}
+
+// body returns the part of b that is encrypted: everything after the type byte, or after the two type bytes
+// of core packets.
+func body(b []byte) ([]byte, error) {
+	if len(b) > MaxPacketSize {
+		return nil, errors.Errorf("vie: %d bytes datagram exceeds %d bytes", len(b), MaxPacketSize)
+	}
+	if len(b) > 0 && b[0] == 0x00 {
+		if len(b) < 2 {
+			return nil, nil
+		}
+		return b[2:], nil
+	}
+	if len(b) < 1 {
+		return nil, nil
+	}
+	return b[1:], nil
+}
+
+// word reads the 32 bit word at off, zero padded past the end of b.
+func word(b []byte, off int) uint32 {
+	if off+4 <= len(b) {
+		return endian.Uint32(b[off:])
+	}
+
+	var w [4]byte
+	copy(w[:], b[off:])
+	return endian.Uint32(w[:])
+}
+
+// putWord writes the 32 bit word at off, truncated at the end of b.
+func putWord(b []byte, off int, v uint32) {
+	if off+4 <= len(b) {
+		endian.PutUint32(b[off:], v)
+		return
+	}
+
+	var w [4]byte
+	endian.PutUint32(w[:], v)
+	copy(b[off:], w[:])
+}
+
+// Encrypt encrypts a datagram in place.
+func (c *Cipher) Encrypt(b []byte) error {
+	data, err := body(b)
+	if err != nil {
+		return err
+	}
+
+	work := c.key
+	for i, off := 0, 0; off < len(data); i, off = i+1, off+4 {
+		work ^= word(data, off) ^ c.table[i]
+		putWord(data, off, work)
+	}
+
+	return nil
+}
+
+// Decrypt decrypts a datagram in place.
+func (c *Cipher) Decrypt(b []byte) error {
+	data, err := body(b)
+	if err != nil {
+		return err
+	}
+
+	work := c.key
+	for i, off := 0, 0; off < len(data); i, off = i+1, off+4 {
+		w := word(data, off)
+		putWord(data, off, w^c.table[i]^work)
+		work = w
+	}
+
+	return nil
+}
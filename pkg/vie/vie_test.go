@@ -0,0 +1,123 @@
+package vie
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// referenceTable builds the key table with a plain division, the Park-Miller step NewCipher computes with a
+// multiply and shift.
+func referenceTable(key uint32) [MaxPacketSize / 4]uint32 {
+	var shorts [MaxPacketSize / 2]uint16
+	k := int32(key)
+	for i := range shorts {
+		k = (k%127773)*16807 - (k/127773)*2836 + 123
+		if k <= 0 {
+			k += 0x7FFFFFFF
+		}
+		shorts[i] = uint16(k)
+	}
+
+	var table [MaxPacketSize / 4]uint32
+	for i := range table {
+		table[i] = uint32(shorts[2*i]) | uint32(shorts[2*i+1])<<16
+	}
+	return table
+}
+
+func TestTableMatchesReference(t *testing.T) {
+	keys := []uint32{1, 0x7fffffff, 0x80000000, 0x80000001, 0xffffffff, 127773, 0xfffe0cdb}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		keys = append(keys, r.Uint32())
+	}
+
+	for _, key := range keys {
+		if got, want := NewCipher(key).table, referenceTable(key); got != want {
+			t.Fatalf("key %#08x: table differs from the reference", key)
+		}
+	}
+}
+
+// Known answers. They are not taken from a server capture: they were computed by this implementation once its
+// table matched the division-based reference, and pin it against regressions.
+func TestKnownAnswers(t *testing.T) {
+	tests := []struct {
+		key        uint32
+		table      [4]uint32
+		core, game []byte // encryption of coreIn and gameIn
+	}{
+		{
+			key:   0x01234567,
+			table: [4]uint32{0x87da6e41, 0xb887fbe5, 0xa390cfe8, 0xe5557152},
+			core:  []byte{0x00, 0x03, 0x26, 0x2b, 0xf9, 0x86, 0xc2, 0xd0, 0x7e, 0x3e, 0x2a},
+			game:  []byte{0x03, 0x4e, 0x4e, 0x95, 0xea, 0xc4},
+		},
+		{
+			key:   0xdeadbeef,
+			table: [4]uint32{0x63b82c4c, 0x0a72c8c5, 0xd7feed24, 0xa2f96ab9},
+			core:  []byte{0x00, 0x03, 0xa3, 0x92, 0x15, 0xbd, 0x67, 0x5a, 0x67, 0xb7, 0x43},
+			game:  []byte{0x03, 0xcb, 0xf7, 0x79, 0xd1, 0x61},
+		},
+		{
+			key:   0x80000001,
+			table: [4]uint32{0x8bb8007b, 0xea33dd93, 0xee51c299, 0xae510c83},
+			core:  []byte{0x00, 0x03, 0x7a, 0x00, 0xb8, 0x0b, 0xe8, 0xdd, 0x8b, 0xe1, 0x71},
+			game:  []byte{0x03, 0x12, 0x65, 0xd4, 0x67, 0xee},
+		},
+	}
+
+	coreIn := []byte{0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}
+	gameIn := []byte{0x03, 'h', 'e', 'l', 'l', 'o'}
+
+	for _, tt := range tests {
+		c := NewCipher(tt.key)
+		if got := [4]uint32{c.table[0], c.table[1], c.table[2], c.table[3]}; got != tt.table {
+			t.Errorf("key %#08x: table starts with %#08x, want %#08x", tt.key, got, tt.table)
+		}
+
+		for _, v := range []struct{ in, want []byte }{{coreIn, tt.core}, {gameIn, tt.game}} {
+			b := append([]byte(nil), v.in...)
+			if err := c.Encrypt(b); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, v.want) {
+				t.Errorf("key %#08x: Encrypt(% x) = % x, want % x", tt.key, v.in, b, v.want)
+			}
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := NewCipher(0xdeadbeef)
+	for n := 0; n <= MaxPacketSize; n++ {
+		for _, first := range []byte{0x00, 0x03} {
+			b := make([]byte, n)
+			for i := range b {
+				b[i] = byte(i * 7)
+			}
+			if n > 0 {
+				b[0] = first
+			}
+			orig := append([]byte(nil), b...)
+
+			if err := c.Encrypt(b); err != nil {
+				t.Fatal(err)
+			}
+			if n > 6 && bytes.Equal(b, orig) {
+				t.Fatalf("%d bytes: Encrypt changed nothing", n)
+			}
+			if err := c.Decrypt(b); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, orig) {
+				t.Fatalf("%d bytes: round trip gave % x, want % x", n, b, orig)
+			}
+		}
+	}
+
+	if err := c.Encrypt(make([]byte, MaxPacketSize+1)); err == nil {
+		t.Error("Encrypt accepted a datagram over MaxPacketSize")
+	}
+}